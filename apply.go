@@ -0,0 +1,184 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EntrySpec describes a desired host entry in a declarative spec
+type EntrySpec struct {
+	IP       string   `json:"ip" yaml:"ip"`
+	Hostname string   `json:"hostname" yaml:"hostname"`
+	Aliases  []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Comment  string   `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// ChangeKind is the kind of operation performed by Apply
+type ChangeKind string
+
+const (
+	ChangeAdd    ChangeKind = "add"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// Change is an operation performed by Apply, the entry position is the one it
+// had before a delete and the one it has after an add
+type Change struct {
+	Kind  ChangeKind `json:"kind"`
+	Entry HostEntry  `json:"entry"`
+}
+
+// ParseSpec reads a JSON or YAML list of entry specs and validates them as
+// host entries
+func ParseSpec(reader io.Reader) ([]HostEntry, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]EntrySpec, 0)
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		err = json.Unmarshal(trimmed, &specs)
+	} else {
+		err = yaml.UnmarshalStrict(data, &specs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec: %s", err)
+	}
+
+	entries := make([]HostEntry, len(specs))
+	for n, spec := range specs {
+		entry, err := NewHostEntry(spec.IP, spec.Hostname, spec.Comment, spec.Aliases...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec entry %d - %s", n, err)
+		}
+
+		if entry.isComment {
+			return nil, fmt.Errorf("invalid spec entry %d - ip address and hostname are required", n)
+		}
+		entries[n] = *entry
+	}
+
+	return entries, nil
+}
+
+// Apply reconciles the entries with the desired ones using the minimal set of
+// adds and deletes. For every hostname in desired, existing enabled entries of
+// that hostname that match a desired entry are kept, the others are replaced in
+// place by the desired entries left over or deleted, and remaining desired
+// entries are appended. With prune, enabled entries for hostnames missing from
+// desired are deleted as well. Hostnames are compared in canonical form.
+// Comment lines and disabled entries are never touched.
+func (hfc *hostsFileCtl) Apply(desired []HostEntry, prune bool) ([]Change, error) {
+
+	wanted := make(map[string][]HostEntry)
+	order := make([]string, 0)
+	for n, entry := range desired {
+		if err := entry.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid desired entry %d - %s", n, err)
+		}
+
+		if err := hfc.validateNames(&entry); err != nil {
+			return nil, fmt.Errorf("invalid desired entry %d - %s", n, err)
+		}
+
+		if entry.isComment || entry.Disabled {
+			return nil, fmt.Errorf("invalid desired entry %d - must be an enabled entry", n)
+		}
+
+		entry.id = 0
+		name := CanonicalName(entry.Hostname)
+		if _, ok := wanted[name]; !ok {
+			order = append(order, name)
+		}
+		wanted[name] = append(wanted[name], entry)
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	// Keep existing entries that already match
+	keep := make(map[int]bool)
+	for _, entry := range hfc.entries {
+
+		if entry.isComment || entry.Disabled {
+			keep[entry.Position] = true
+			continue
+		}
+
+		name := CanonicalName(entry.Hostname)
+		candidates, ok := wanted[name]
+		if !ok {
+			keep[entry.Position] = !prune
+			continue
+		}
+
+		key := mergeKey(entry.canonical())
+		for n, candidate := range candidates {
+			if mergeKey(candidate.canonical()) == key {
+				keep[entry.Position] = true
+				wanted[name] = append(candidates[:n:n], candidates[n+1:]...)
+				break
+			}
+		}
+	}
+
+	changes := make([]Change, 0)
+	entries := make([]HostEntry, 0, len(hfc.entries))
+	var leading []byte
+	for _, entry := range hfc.entries {
+
+		if keep[entry.Position] {
+			if hfc.lossless && leading != nil {
+				entry.source = withLeading(entry.source, append(leading, entry.leading()...))
+				leading = nil
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		changes = append(changes, Change{Kind: ChangeDelete, Entry: entry})
+
+		// Replace in place with a desired entry for the same hostname if one is left
+		name := CanonicalName(entry.Hostname)
+		if remaining := wanted[name]; len(remaining) > 0 {
+			replacement := remaining[0]
+			wanted[name] = remaining[1:]
+
+			if hfc.lossless {
+				replacement.source = withLeading(nil, append(leading, entry.leading()...))
+				leading = nil
+			}
+
+			replacement.Position = len(entries)
+			changes = append(changes, Change{Kind: ChangeAdd, Entry: replacement})
+			entries = append(entries, replacement)
+			continue
+		}
+
+		leading = append(leading, entry.leading()...)
+	}
+
+	if leading != nil {
+		hfc.trailing = append(leading, hfc.trailing...)
+	}
+
+	for _, hostname := range order {
+		for _, entry := range wanted[hostname] {
+			entry.Position = len(entries)
+			changes = append(changes, Change{Kind: ChangeAdd, Entry: entry})
+			entries = append(entries, entry)
+		}
+	}
+
+	hfc.forget()
+	hfc.entries = entries
+	hfc.updatePosition()
+	return changes, nil
+}
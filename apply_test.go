@@ -0,0 +1,117 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testSpecYAML = `
+- ip: 10.0.0.1
+  hostname: api.internal
+  aliases: [api]
+  comment: staging api
+- ip: 10.0.0.2
+  hostname: db.internal
+`
+
+func TestParseSpec(t *testing.T) {
+
+	entries, err := ParseSpec(strings.NewReader(testSpecYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].String() != "10.0.0.1\tapi.internal\tapi\t# staging api" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	entries, err = ParseSpec(strings.NewReader(`[{"ip": "10.0.0.2", "hostname": "db.internal"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Hostname != "db.internal" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	if _, err := ParseSpec(strings.NewReader(`- ip: 10.0.0.1`)); err == nil {
+		t.Fatalf("expecting spec without hostname to be rejected")
+	}
+
+	if _, err := ParseSpec(strings.NewReader(`- ip: 10.0.0.1
+  hostname: api.internal
+  alias: api`)); err == nil {
+		t.Fatalf("expecting spec with unknown fields to be rejected")
+	}
+}
+
+func TestHostsFileCtl_Apply(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_Apply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	original := "# Services\n10.9.9.9 api.internal\n\n127.0.0.1 localhost\n10.0.0.2 db.internal\n10.0.0.3 old.internal\n"
+	if _, err := f.WriteString(original); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired, err := ParseSpec(strings.NewReader(testSpecYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := hctl.Apply(desired, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// api.internal is replaced in place, db.internal already matches
+	if len(changes) != 2 || changes[0].Kind != ChangeDelete || changes[1].Kind != ChangeAdd || changes[1].Entry.Position != 1 {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Replace(original, "10.9.9.9 api.internal", desired[0].String(), 1)
+	if buf.String() != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// Pruning removes what is not in the spec, except comments
+	changes, err = hctl.Apply(desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 2 || changes[0].Entry.Hostname != "localhost" || changes[1].Entry.Hostname != "old.internal" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	if len(hctl.Entries()) != 3 {
+		t.Fatalf("expecting comment and desired entries only, got: %v", hctl.Entries())
+	}
+
+	changes, err = hctl.Apply(desired, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 0 {
+		t.Fatalf("expecting no changes when already applied, got: %v", changes)
+	}
+}
@@ -0,0 +1,113 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// replaceFile writes the contents produced by write to a temporary file in the
+// same directory as path, fsyncs it, copies the mode and owner of path onto it
+// and renames it over path so readers never observe a partially written file.
+// Files that cannot be replaced by a rename, such as the bind mounted hosts
+// file of a docker container (EBUSY), are rewritten in place instead. A
+// symlinked path, such as /etc/hosts on NixOS, is written through to its target.
+func replaceFile(path string, write func(io.Writer) (int, error)) (int, error) {
+
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, err
+	}
+
+	s, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return 0, err
+	}
+
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	count, err := write(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tmp.Chmod(s.Mode()); err != nil {
+		return 0, err
+	}
+
+	// Only a privileged user can hand the file to another owner
+	if err := chown(tmp, s); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return rewriteFile(path, s.Mode(), write)
+		}
+		return 0, err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		if errors.Is(err, syscall.EBUSY) {
+			return rewriteFile(path, s.Mode(), write)
+		}
+		return 0, err
+	}
+	renamed = true
+
+	syncDir(filepath.Dir(path))
+	return count, nil
+}
+
+// rewriteFile truncates and rewrites path in place, restoring the original
+// contents if anything fails along the way
+func rewriteFile(path string, mode os.FileMode, write func(io.Writer) (int, error)) (count int, err error) {
+
+	// Read in the existing contents to revert in case of failure
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read existing file to make backup: %s", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			ioutil.WriteFile(path, contents, mode)
+		}
+	}()
+
+	count, err = write(f)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return count, f.Close()
+}
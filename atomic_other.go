@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package go_hostctl
+
+import (
+	"os"
+)
+
+// chown is a no-op, ownership is not carried by a unix uid/gid on this platform
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op, directories cannot be flushed on this platform
+func syncDir(dir string) {}
@@ -0,0 +1,241 @@
+package go_hostctl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BackupTimeFormat = "20060102T150405.000000000Z"
+	backupInfix      = ".bak."
+)
+
+// Backup is a copy of the hosts file taken by Sync before replacing it
+type Backup struct {
+	Path string
+	Time time.Time
+}
+
+// WithBackups makes Sync keep a copy of the hosts file before replacing it as
+// <hosts>.bak.<timestamp> in dir (the hosts file directory if empty), only the
+// newest keep copies are retained. A keep of zero only sets the directory used
+// by Backup, Backups and Restore.
+func WithBackups(dir string, keep int) Option {
+	return func(hfc *hostsFileCtl) error {
+		if keep < 0 {
+			return fmt.Errorf("invalid number of backups to keep: %d", keep)
+		}
+		hfc.backupDir = dir
+		hfc.backupKeep = keep
+		return nil
+	}
+}
+
+func (hfc *hostsFileCtl) backupDirectory() string {
+	if len(hfc.backupDir) != 0 {
+		return hfc.backupDir
+	}
+	return filepath.Dir(hfc.hostsFile)
+}
+
+// backup stores contents as a new backup when automatic backups are enabled
+func (hfc *hostsFileCtl) backup(contents []byte) error {
+
+	if hfc.backupKeep <= 0 {
+		return nil
+	}
+
+	_, err := hfc.writeBackup(contents)
+	return err
+}
+
+// writeBackup stores contents as a new backup and removes the ones no longer kept
+func (hfc *hostsFileCtl) writeBackup(contents []byte) (Backup, error) {
+
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(hfc.hostsFile); err == nil {
+		mode = stat.Mode()
+	}
+
+	dir := hfc.backupDirectory()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Backup{}, err
+	}
+
+	now := time.Now().UTC()
+	backup := Backup{
+		Path: filepath.Join(dir, filepath.Base(hfc.hostsFile)+backupInfix+now.Format(BackupTimeFormat)),
+		Time: now,
+	}
+
+	if err := ioutil.WriteFile(backup.Path, contents, mode); err != nil {
+		return Backup{}, fmt.Errorf("failed to write backup: %s", err)
+	}
+
+	if hfc.backupKeep <= 0 {
+		return backup, nil
+	}
+
+	backups, err := hfc.Backups()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	for n := hfc.backupKeep; n < len(backups); n++ {
+		if err := os.Remove(backups[n].Path); err != nil {
+			return Backup{}, fmt.Errorf("failed to remove old backup: %s", err)
+		}
+	}
+
+	return backup, nil
+}
+
+// Backup takes a backup of the hosts file as it is on disk right now
+func (hfc *hostsFileCtl) Backup() (Backup, error) {
+
+	unlock, err := hfc.lock(false)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer unlock()
+
+	contents, err := ioutil.ReadFile(hfc.hostsFile)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	return hfc.writeBackup(contents)
+}
+
+// Backups lists the backups of the hosts file, newest first
+func (hfc *hostsFileCtl) Backups() ([]Backup, error) {
+
+	dir := hfc.backupDirectory()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Backup{}, nil
+		}
+		return nil, err
+	}
+
+	prefix := filepath.Base(hfc.hostsFile) + backupInfix
+	backups := make([]Backup, 0)
+	for _, file := range files {
+
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) {
+			continue
+		}
+
+		ts, err := time.Parse(BackupTimeFormat, strings.TrimPrefix(file.Name(), prefix))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{
+			Path: filepath.Join(dir, file.Name()),
+			Time: ts,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// Restore validates the backup by parsing every entry and replaces both the
+// hosts file and the in-memory entries with it, the replaced file is backed up
+func (hfc *hostsFileCtl) Restore(backup string) error {
+
+	snap, contents, err := hfc.loadBackup(backup)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := hfc.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	current, err := ioutil.ReadFile(hfc.hostsFile)
+	if err != nil {
+		return err
+	}
+
+	if err := hfc.backup(current); err != nil {
+		return err
+	}
+
+	if _, err := replaceFile(hfc.hostsFile, func(writer io.Writer) (int, error) {
+		return writer.Write(contents)
+	}); err != nil {
+		return err
+	}
+
+	hfc.reset(snap)
+	return nil
+}
+
+// DiffBackup returns a unified diff from the hosts file on disk to the backup,
+// it is empty when Restore would not change anything
+func (hfc *hostsFileCtl) DiffBackup(backup string) (string, error) {
+
+	_, contents, err := hfc.loadBackup(backup)
+	if err != nil {
+		return "", err
+	}
+
+	unlock, err := hfc.lock(false)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	current, err := ioutil.ReadFile(hfc.hostsFile)
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(hfc.hostsFile, backup, current, contents), nil
+}
+
+// loadBackup reads and validates a backup by parsing every entry, lines that
+// cannot be parsed are rejected in lenient mode too
+func (hfc *hostsFileCtl) loadBackup(backup string) (*snapshot, []byte, error) {
+
+	contents, err := ioutil.ReadFile(backup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, trailing, eol, diagnostics, err := hfc.parse(bufio.NewReader(bytes.NewReader(contents)), nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid backup %s: %s", backup, err)
+	}
+
+	if len(diagnostics) > 0 {
+		return nil, nil, fmt.Errorf("invalid backup %s: invalid host entry on line %d - %s", backup, diagnostics[0].Line, diagnostics[0].Reason)
+	}
+
+	return &snapshot{
+		entries:  entries,
+		trailing: trailing,
+		eol:      eol,
+		hash:     sha256.Sum256(contents),
+	}, contents, nil
+}
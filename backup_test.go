@@ -0,0 +1,89 @@
+package go_hostctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHostsFileCtl_Backups(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestHostsFileCtl_Backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostsFile, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(hostsFile, WithBackups(filepath.Join(dir, "backups"), 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []*HostEntry{hostEntry1, hostEntry2, hostEntry3} {
+		if err := hctl.Add(*entry, -1); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := hctl.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := hctl.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("expecting 2 backups to be kept, got: %d", len(backups))
+	}
+
+	if !backups[0].Time.After(backups[1].Time) {
+		t.Fatalf("expecting newest backup first, got: %v", backups)
+	}
+
+	// Oldest kept backup holds localhost and the first entry
+	diff, err := hctl.DiffBackup(backups[1].Path)
+	if err != nil || !strings.Contains(diff, "-"+hostEntry2.String()) {
+		t.Fatalf("expecting the restore to drop %q, got: %q, %v", hostEntry2.String(), diff, err)
+	}
+
+	if err := hctl.Restore(backups[1].Path); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := hctl.Entries()
+	if len(entries) != 2 || entries[1].Hostname != hostEntry1.Hostname {
+		t.Fatalf("expecting restored entries, got: %v", entries)
+	}
+
+	check, err := NewHostFileCtl(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(check.Entries()) != 2 {
+		t.Fatalf("expecting restored file, got: %v", check.Entries())
+	}
+
+	// Invalid backups are never swapped in
+	invalid := filepath.Join(dir, "backups", "hosts.bak.invalid")
+	if err := ioutil.WriteFile(invalid, []byte("not_an_ip localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Restore(invalid); err == nil {
+		t.Fatalf("expecting invalid backup to be rejected")
+	}
+
+	if _, err := hctl.DiffBackup(invalid); err == nil {
+		t.Fatalf("expecting invalid backup to be rejected by DiffBackup")
+	}
+}
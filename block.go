@@ -0,0 +1,173 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	BlockBeginMarker = "BEGIN hostctl:"
+	BlockEndMarker   = "END hostctl:"
+)
+
+var (
+	ErrBlockNotFound = errors.New("managed block not found")
+)
+
+// markerName returns the block name if the entry is a block marker of the given kind
+func markerName(entry HostEntry, marker string) (string, bool) {
+	if !entry.isComment {
+		return "", false
+	}
+
+	comment := strings.TrimSpace(strings.TrimPrefix(Normalize(&entry.Comment), "#"))
+	if !strings.HasPrefix(comment, marker) {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(comment, marker)), true
+}
+
+func isBlockMarker(entry HostEntry) bool {
+	if _, ok := markerName(entry, BlockBeginMarker); ok {
+		return true
+	}
+	_, ok := markerName(entry, BlockEndMarker)
+	return ok
+}
+
+func newBlockMarker(marker, name string) (HostEntry, error) {
+	entry, err := NewHostEntry("", "", marker+name)
+	if err != nil {
+		return HostEntry{}, err
+	}
+	return *entry, nil
+}
+
+// findBlock returns the positions of the begin and end markers of the named block or -1 if it does not exist
+func (hfc *hostsFileCtl) findBlock(name string) (int, int, error) {
+
+	begin := -1
+	for n, entry := range hfc.entries {
+
+		if begin < 0 {
+			if blockName, ok := markerName(entry, BlockBeginMarker); ok && blockName == name {
+				begin = n
+			}
+			continue
+		}
+
+		if blockName, ok := markerName(entry, BlockEndMarker); ok && blockName == name {
+			return begin, n, nil
+		}
+	}
+
+	if begin >= 0 {
+		return -1, -1, fmt.Errorf("block %s started at position %d has no end marker", name, begin)
+	}
+
+	return -1, -1, nil
+}
+
+// Block returns the entries between the begin and end markers of the named block
+func (hfc *hostsFileCtl) Block(name string) ([]HostEntry, error) {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	begin, end, err := hfc.findBlock(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if begin < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBlockNotFound, name)
+	}
+
+	entries := make([]HostEntry, end-begin-1)
+	copy(entries, hfc.entries[begin+1:end])
+	return entries, nil
+}
+
+// ReplaceBlock replaces the entries of the named block, creating the block at
+// the end of the file if it does not exist yet
+func (hfc *hostsFileCtl) ReplaceBlock(name string, entries []HostEntry) error {
+
+	if !IsValidName(name) {
+		return fmt.Errorf("invalid block name: %s", name)
+	}
+
+	block := make([]HostEntry, len(entries))
+	for n, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			return fmt.Errorf("invalid block entry %d - %s", n, err)
+		}
+
+		if err := hfc.validateNames(&entry); err != nil {
+			return fmt.Errorf("invalid block entry %d - %s", n, err)
+		}
+
+		if isBlockMarker(entry) {
+			return fmt.Errorf("block entry %d cannot be a block marker: %s", n, entry.Comment)
+		}
+
+		entry.id = 0
+		block[n] = entry
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	begin, end, err := hfc.findBlock(name)
+	if err != nil {
+		return err
+	}
+
+	hfc.forget()
+	defer hfc.updatePosition()
+
+	if begin < 0 {
+		beginMarker, err := newBlockMarker(BlockBeginMarker, name)
+		if err != nil {
+			return err
+		}
+
+		endMarker, err := newBlockMarker(BlockEndMarker, name)
+		if err != nil {
+			return err
+		}
+
+		hfc.entries = append(hfc.entries, beginMarker)
+		hfc.entries = append(hfc.entries, block...)
+		hfc.entries = append(hfc.entries, endMarker)
+		return nil
+	}
+
+	tail := append([]HostEntry{}, hfc.entries[end:]...)
+	hfc.entries = append(append(hfc.entries[:begin+1], block...), tail...)
+	return nil
+}
+
+// RemoveBlock removes the named block including its markers, it is a no-op if the block does not exist
+func (hfc *hostsFileCtl) RemoveBlock(name string) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	begin, end, err := hfc.findBlock(name)
+	if err != nil {
+		return err
+	}
+
+	if begin < 0 {
+		return nil
+	}
+
+	hfc.forget()
+	defer hfc.updatePosition()
+
+	hfc.keepLeading(begin, end)
+	hfc.entries = append(hfc.entries[:begin], hfc.entries[end+1:]...)
+	return nil
+}
@@ -0,0 +1,93 @@
+package go_hostctl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHostsFileCtl_ReplaceBlock(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_ReplaceBlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString("127.0.0.1 localhost\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Block("myteam"); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("expecting block not found error, got: %v", err)
+	}
+
+	if err := hctl.ReplaceBlock("myteam", []HostEntry{*hostEntry1, *hostEntry2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err = NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.ReplaceBlock("myteam", []HostEntry{*hostEntry3}); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := hctl.Block("myteam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(block) != 1 || block[0].Hostname != hostEntry3.Hostname {
+		t.Fatalf("expecting only %s in block, got: %v", hostEntry3.Hostname, block)
+	}
+
+	entries := hctl.Entries()
+	if len(entries) != 4 || entries[0].Hostname != "localhost" || entries[2].Position != 2 {
+		t.Fatalf("expecting localhost followed by the block, got: %v", entries)
+	}
+
+	if err := hctl.RemoveBlock("myteam"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hctl.Entries()) != 1 {
+		t.Fatalf("expecting only localhost to remain, got: %v", hctl.Entries())
+	}
+}
+
+func TestHostsFileCtl_BlockUnterminated(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_BlockUnterminated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString("# BEGIN hostctl:myteam\n1.1.1.1 host_one\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Block("myteam"); err == nil {
+		t.Fatalf("expecting an error for a block without an end marker")
+	}
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	. "github.com/zeronopbot/go-hostctl"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	hostsFile    string
+	backupDir    string
+	keep         int
+	lockTimeout  time.Duration
+	dryRun       bool
+	mappedEqual  bool
+	preserveCase bool
+	names        string
+	lenient      bool
+}
+
+// open loads the hosts file, edits keep the formatting of untouched lines
+func (cfg *config) open(opts ...Option) (HostFileCtl, error) {
+	opts = append(opts, WithLockTimeout(cfg.lockTimeout), WithBackups(cfg.backupDir, cfg.keep))
+	if cfg.mappedEqual {
+		opts = append(opts, WithIPv4MappedEqual())
+	}
+	if cfg.preserveCase {
+		opts = append(opts, WithPreserveCase())
+	}
+	if cfg.lenient {
+		opts = append(opts, WithLenient())
+	}
+	switch cfg.names {
+	case "permissive":
+	case "strict":
+		opts = append(opts, WithNameValidator(StrictNames))
+	default:
+		return nil, usageErrorf("invalid name validation: %s", cfg.names)
+	}
+	return NewHostFileCtl(cfg.hostsFile, opts...)
+}
+
+// sync writes the changes to the hosts file, or only prints them in dry-run
+// mode reporting pending changes with exitNoMatch
+func (cfg *config) sync(hctl HostFileCtl) error {
+
+	if !cfg.dryRun {
+		_, err := hctl.Sync()
+		return err
+	}
+
+	diff, err := hctl.Diff()
+	if err != nil {
+		return err
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	fmt.Print(diff)
+	return &exitCodeError{code: exitNoMatch}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return usageErrorf("%s: %s", flags.Name(), err)
+	}
+	return nil
+}
+
+// Output formats
+const (
+	outputText      = "text"
+	outputJSON      = "json"
+	outputJSONLines = "jsonl"
+)
+
+// output is how entries are printed
+type output struct {
+	format  string
+	unicode bool
+}
+
+func registerOutput(flags *flag.FlagSet) *output {
+	out := &output{}
+	flags.StringVar(&out.format, "output", outputText, "Output format: text, json or jsonl")
+	flags.StringVar(&out.format, "o", outputText, "Shorthand for -output")
+	flags.BoolVar(&out.unicode, "unicode", false, "Show internationalized names in Unicode instead of punycode (xn--)")
+	return out
+}
+
+func printEntries(entries []HostEntry, out *output) error {
+
+	if out.unicode {
+		unicode := make([]HostEntry, len(entries))
+		for n, entry := range entries {
+			unicode[n] = entry.Unicode()
+		}
+		entries = unicode
+	}
+
+	switch out.format {
+	case outputText:
+		for _, entry := range entries {
+			fmt.Printf("%d\t%s\n", entry.Position, entry.String())
+		}
+		return nil
+
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+
+	case outputJSONLines:
+		return WriteJSONLines(os.Stdout, entries)
+
+	default:
+		return usageErrorf("invalid output format: %s", out.format)
+	}
+}
+
+// selector picks entries by exactly one of ip, hostname, alias, address range or name pattern
+type selector struct {
+	ip         string
+	host       string
+	alias      string
+	cidr       string
+	glob       string
+	regex      string
+	ignoreCase bool
+}
+
+func (s *selector) register(flags *flag.FlagSet) {
+	flags.StringVar(&s.ip, "ip", "", "Match entries by ip address")
+	flags.StringVar(&s.host, "host", "", "Match entries by hostname")
+	flags.StringVar(&s.alias, "alias", "", "Match entries by alias")
+	flags.StringVar(&s.cidr, "cidr", "", "Match entries by CIDR (10.0.0.0/8) or ip range (10.0.0.1-10.0.0.50)")
+	flags.StringVar(&s.glob, "glob", "", "Match entries with a hostname or alias matching a glob pattern (*.internal)")
+	flags.StringVar(&s.regex, "regex", "", "Match entries with a hostname or alias matching a regular expression")
+	flags.BoolVar(&s.ignoreCase, "i", false, "Match -glob and -regex patterns case-insensitively")
+}
+
+func (s *selector) set() int {
+	count := 0
+	for _, value := range []string{s.ip, s.host, s.alias, s.cidr, s.glob, s.regex} {
+		if len(value) != 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *selector) lookup(hctl HostFileCtl) ([]HostEntry, error) {
+
+	if len(hctl.Entries()) == 0 {
+		return []HostEntry{}, nil
+	}
+
+	switch {
+	case len(s.ip) != 0:
+		return hctl.GetIP(s.ip)
+	case len(s.host) != 0:
+		return hctl.GetHostname(s.host)
+	case len(s.cidr) != 0:
+		entries, err := hctl.GetRange(s.cidr)
+		if err != nil {
+			return nil, usageErrorf("%s", err)
+		}
+		return entries, nil
+	case len(s.glob) != 0 || len(s.regex) != 0:
+		query := NameQuery{Pattern: s.glob, CaseInsensitive: s.ignoreCase}
+		if len(s.regex) != 0 {
+			query = NameQuery{Pattern: s.regex, Regex: true, CaseInsensitive: s.ignoreCase}
+		}
+
+		matches, err := hctl.FindNames(query)
+		if err != nil {
+			return nil, usageErrorf("%s", err)
+		}
+
+		entries := make([]HostEntry, len(matches))
+		for n, match := range matches {
+			entries[n] = match.Entry
+		}
+		return entries, nil
+	default:
+		return hctl.GetAlias(s.alias)
+	}
+}
+
+// first returns the entry the resolver uses for the exact match selectors
+func (s *selector) first(hctl HostFileCtl) ([]HostEntry, error) {
+
+	if len(hctl.Entries()) == 0 {
+		return []HostEntry{}, nil
+	}
+
+	var entry HostEntry
+	var err error
+	switch {
+	case len(s.ip) != 0:
+		entry, err = hctl.GetFirstIP(s.ip)
+	case len(s.host) != 0:
+		entry, err = hctl.GetFirstHostname(s.host)
+	case len(s.alias) != 0:
+		entry, err = hctl.GetFirstAlias(s.alias)
+	default:
+		return nil, usageErrorf("find: -first expects one of -ip, -host or -alias")
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		return []HostEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []HostEntry{entry}, nil
+}
+
+func listCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("list")
+	output := registerOutput(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	return printEntries(hctl.Entries(), output)
+}
+
+func addCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("add")
+	comment := flags.String("c", "", "Inline comment")
+	position := flags.Int("p", -1, "Position to insert the entry at, -1 appends")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 2 {
+		return usageErrorf("add: expecting an ip address and a hostname")
+	}
+
+	entry, err := NewHostEntry(flags.Arg(0), flags.Arg(1), *comment, flags.Args()[2:]...)
+	if err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open(WithLossless())
+	if err != nil {
+		return err
+	}
+
+	if err := hctl.Add(*entry, *position); err != nil {
+		return err
+	}
+
+	return cfg.sync(hctl)
+}
+
+func rmCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("rm")
+	sel := &selector{}
+	sel.register(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open(WithLossless())
+	if err != nil {
+		return err
+	}
+
+	positions := make([]int, 0)
+	switch {
+	case sel.set() == 0 && flags.NArg() == 1:
+		position, err := strconv.Atoi(flags.Arg(0))
+		if err != nil || position < 0 {
+			return usageErrorf("rm: invalid position: %s", flags.Arg(0))
+		}
+		if position >= len(hctl.Entries()) {
+			return &exitCodeError{code: exitNoMatch}
+		}
+		positions = append(positions, position)
+
+	case sel.set() == 1 && flags.NArg() == 0:
+		entries, err := sel.lookup(hctl)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			positions = append(positions, entry.Position)
+		}
+
+	default:
+		return usageErrorf("rm: expecting a position or one of -ip, -host, -alias, -cidr, -glob or -regex")
+	}
+
+	if len(positions) == 0 {
+		return &exitCodeError{code: exitNoMatch}
+	}
+
+	if err := hctl.DeletePositions(positions...); err != nil {
+		return err
+	}
+
+	return cfg.sync(hctl)
+}
+
+func findCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("find")
+	output := registerOutput(flags)
+	first := flags.Bool("first", false, "Only show the first enabled match, the one the resolver uses")
+	sel := &selector{}
+	sel.register(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if sel.set() != 1 || flags.NArg() != 0 {
+		return usageErrorf("find: expecting one of -ip, -host, -alias, -cidr, -glob or -regex")
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	lookup := sel.lookup
+	if *first {
+		lookup = sel.first
+	}
+
+	entries, err := lookup(hctl)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		if output.format == outputJSON {
+			fmt.Println("[]")
+		}
+		return &exitCodeError{code: exitNoMatch}
+	}
+
+	return printEntries(entries, output)
+}
+
+func setCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("set")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() < 2 {
+		return usageErrorf("set: expecting a hostname and an ip address")
+	}
+
+	hostname, ip, aliases := flags.Arg(0), flags.Arg(1), flags.Args()[2:]
+	hctl, err := cfg.open(WithLossless())
+	if err != nil {
+		return err
+	}
+
+	// Keeps the comment and, unless new ones are given, the aliases of an existing entry
+	if _, err := hctl.Upsert(hostname, ip, aliases...); err != nil {
+		return err
+	}
+
+	return cfg.sync(hctl)
+}
+
+func applyCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("apply")
+	prune := flags.Bool("prune", false, "Delete entries for hostnames missing from the spec")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("apply: expecting a spec file, - reads stdin")
+	}
+
+	spec := os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		spec = f
+	}
+
+	desired, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open(WithLossless())
+	if err != nil {
+		return err
+	}
+
+	changes, err := hctl.Apply(desired, *prune)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if cfg.dryRun {
+		return cfg.sync(hctl)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		prefix := "+"
+		if change.Kind == ChangeDelete {
+			prefix = "-"
+		}
+		fmt.Printf("%s %s\n", prefix, change.Entry.String())
+	}
+	return nil
+}
+
+func enableCmd(cfg *config, args []string) error {
+	return profileCmd(cfg, "enable", args, HostFileCtl.EnableProfile)
+}
+
+func disableCmd(cfg *config, args []string) error {
+	return profileCmd(cfg, "disable", args, HostFileCtl.DisableProfile)
+}
+
+func profileCmd(cfg *config, name string, args []string, toggle func(HostFileCtl, string) error) error {
+
+	flags := newFlagSet(name)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("%s: expecting a profile name", name)
+	}
+
+	hctl, err := cfg.open(WithLossless())
+	if err != nil {
+		return err
+	}
+
+	if err := toggle(hctl, flags.Arg(0)); err != nil {
+		return err
+	}
+
+	return cfg.sync(hctl)
+}
+
+func fmtCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("fmt")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	return cfg.sync(hctl)
+}
+
+func lintCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("lint")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	// Report every line that cannot be parsed rather than only the first one
+	hctl, err := cfg.open(WithLenient())
+	if err != nil {
+		fmt.Printf("%s: %s\n", cfg.hostsFile, err)
+		return &exitCodeError{code: exitNoMatch}
+	}
+
+	problems := 0
+	for _, diagnostic := range hctl.Diagnostics() {
+		fmt.Printf("%s:%s\n", cfg.hostsFile, diagnostic)
+		problems++
+	}
+
+	if _, err := hctl.Profiles(); err != nil {
+		fmt.Printf("%s: %s\n", cfg.hostsFile, err)
+		problems++
+	}
+
+	// The same name mapped more than once per address family, only the first one resolves
+	for _, duplicate := range hctl.Duplicates() {
+		fmt.Printf("%s:%d: duplicate name %s, first mapped at position %d\n", cfg.hostsFile, duplicate.Entry.Position, duplicate.Name, duplicate.First)
+		problems++
+	}
+
+	if problems > 0 {
+		return &exitCodeError{code: exitNoMatch}
+	}
+
+	return nil
+}
+
+func diffCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("diff")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	dryRun := *cfg
+	dryRun.dryRun = true
+	return dryRun.sync(hctl)
+}
+
+func backupCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("backup")
+	list := flags.Bool("l", false, "List backups instead of taking one")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	if !*list && cfg.dryRun {
+		return usageErrorf("backup: a backup cannot be taken with -dry-run")
+	}
+
+	if *list {
+		backups, err := hctl.Backups()
+		if err != nil {
+			return err
+		}
+
+		for _, backup := range backups {
+			fmt.Printf("%s\t%s\n", backup.Time.Format(time.RFC3339), backup.Path)
+		}
+		return nil
+	}
+
+	backup, err := hctl.Backup()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(backup.Path)
+	return nil
+}
+
+func restoreCmd(cfg *config, args []string) error {
+
+	flags := newFlagSet("restore")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 1 {
+		return usageErrorf("restore: expecting at most one backup")
+	}
+
+	hctl, err := cfg.open()
+	if err != nil {
+		return err
+	}
+
+	backup := flags.Arg(0)
+	if len(backup) == 0 {
+		backups, err := hctl.Backups()
+		if err != nil {
+			return err
+		}
+
+		if len(backups) == 0 {
+			return fmt.Errorf("no backups found for %s", cfg.hostsFile)
+		}
+		backup = backups[0].Path
+	}
+
+	if !cfg.dryRun {
+		return hctl.Restore(backup)
+	}
+
+	diff, err := hctl.DiffBackup(backup)
+	if err != nil {
+		return err
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	fmt.Print(diff)
+	return &exitCodeError{code: exitNoMatch}
+}
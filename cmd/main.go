@@ -1,108 +1,169 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	. "github.com/zeronopbot/go-hostctl"
-	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 )
 
-func main() {
-
-	fpath := flag.String("f", "testdata/etc/hosts/mixed_hosts", "Hosts file path")
-	flag.Parse()
-
-	// Open existing host file to copy its entries (for testing)
-	hctlFile1, err := NewHostFileCtl(*fpath)
-	if err != nil {
-		log.Fatal(err)
-	}
+// Exit codes
+const (
+	exitOK       = 0
+	exitNoMatch  = 1 // nothing found, lint problems or pending changes
+	exitUsage    = 2
+	exitError    = 3
+	exitConflict = 4 // hosts file was modified by someone else while editing
+)
 
-	// Remove it if exists
-	os.Remove("/tmp/hosts")
+const usage = `Usage: hostctl [flags] <command> [arguments]
+
+Commands:
+  list [-o text|json|jsonl] [-unicode] list all entries
+  add [-c comment] [-p position] <ip> <hostname> [alias...]
+                                       add an entry
+  rm <position> | <selector>           remove entries
+  find [-o text|json|jsonl] [-unicode] [-first] <selector>
+                                       find entries, -first only the one that resolves
+                                       (-ip, -host or -alias)
+  set <hostname> <ip> [alias...]       point an existing hostname at ip or add it
+  apply [-prune] <spec>                apply a JSON or YAML spec of entries, - reads stdin
+  enable <profile>                     enable every entry of a profile
+  disable <profile>                    disable every entry of a profile
+  fmt                                  rewrite the file in canonical format
+  lint                                 report invalid lines and duplicates
+  diff                                 show what fmt would change
+  backup                               take a backup, -l lists them
+  restore [backup]                     restore a backup, the newest by default
+
+Selectors:
+  -ip <ip> | -host <hostname> | -alias <alias>
+                                       exact match
+  -cidr <range>                        address in a CIDR or start-end range
+  [-i] -glob <pattern> | -regex <expr>
+                                       hostname or alias matches a pattern
+
+Flags:
+`
+
+// usageError is reported with the usage text and exitUsage
+type usageError struct {
+	msg string
+}
 
-	// File we want to "actually" use
-	hctl, err := NewHostFileCtl("/tmp/hosts")
-	if err != nil {
-		log.Fatal(err)
-	}
+func (ue *usageError) Error() string {
+	return ue.msg
+}
 
-	// Show any existing entries
-	for _, entry := range hctlFile1.Entries() {
-		if err := hctl.Add(entry, 0); err != nil {
-			log.Fatal(err)
-		}
-	}
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
 
-	// Delete all localhost ips in loop
-	// Position of all entries are updated after each host operations (e.g. add, delete)
-	for {
-		entries, err := hctl.GetIP("127.0.0.1")
-		if err != nil {
-			log.Fatal(err)
-		}
+// exitCodeError carries an exit code for an outcome that is not a failure, such as no match
+type exitCodeError struct {
+	code int
+}
 
-		if len(entries) <= 0 {
-			break
-		}
+func (ece *exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", ece.code)
+}
 
-		if err := hctl.Delete(entries[0].Position); err != nil {
-			log.Fatal(err)
+func defaultHostsFile() string {
+	if runtime.GOOS == "windows" {
+		root := os.Getenv("SystemRoot")
+		if len(root) == 0 {
+			root = `C:\Windows`
 		}
+		return filepath.Join(root, "System32", "drivers", "etc", "hosts")
 	}
+	return "/etc/hosts"
+}
 
-	// Delete all host_entry_4 host names
-	for {
+type command func(cfg *config, args []string) error
+
+var commands = map[string]command{
+	"list":    listCmd,
+	"add":     addCmd,
+	"rm":      rmCmd,
+	"find":    findCmd,
+	"set":     setCmd,
+	"apply":   applyCmd,
+	"enable":  enableCmd,
+	"disable": disableCmd,
+	"fmt":     fmtCmd,
+	"lint":    lintCmd,
+	"diff":    diffCmd,
+	"backup":  backupCmd,
+	"restore": restoreCmd,
+}
 
-		entries, err := hctl.GetHostname("host_entry_4")
-		if err != nil {
-			log.Fatal(err)
-		}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-		if len(entries) <= 0 {
-			break
-		}
+func run(args []string) int {
+
+	flags := flag.NewFlagSet("hostctl", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
 
-		if err := hctl.Delete(entries[0].Position); err != nil {
-			log.Fatal(err)
+	cfg := &config{}
+	flags.StringVar(&cfg.hostsFile, "f", defaultHostsFile(), "Hosts file path")
+	flags.StringVar(&cfg.backupDir, "backup-dir", "", "Backup directory (defaults to the hosts file directory)")
+	flags.IntVar(&cfg.keep, "keep", 0, "Number of backups kept, a backup is taken before every change when set")
+	flags.BoolVar(&cfg.dryRun, "dry-run", false, "Print the changes as a unified diff instead of writing them, exits with 1 if there are any")
+	flags.BoolVar(&cfg.mappedEqual, "ipv4-mapped-equal", false, "Match IPv4-mapped IPv6 addresses (::ffff:a.b.c.d) with their IPv4 address")
+	flags.BoolVar(&cfg.preserveCase, "preserve-case", false, "Write hostnames and aliases as given instead of lowercase without a trailing dot")
+	flags.StringVar(&cfg.names, "names", "permissive", "Hostname validation, strict (RFC 1123) or permissive (allows underscores)")
+	flags.BoolVar(&cfg.lenient, "lenient", false, "Keep lines that cannot be parsed as they are instead of failing")
+	flags.DurationVar(&cfg.lockTimeout, "lock-timeout", DefaultLockTimeout, "How long to wait for another process editing the hosts file")
+
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
 		}
+		return exitUsage
 	}
 
-	// Delete some_macos alias
-	entries, err := hctl.GetAlias("some_macos")
-	if err != nil {
-		log.Fatal(err)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
 	}
 
-	if len(entries) > 0 {
-		if err := hctl.Delete(entries[0].Position); err != nil {
-			log.Fatal(err)
-		}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "hostctl: unknown command: %s\n", flags.Arg(0))
+		flags.Usage()
+		return exitUsage
 	}
 
-	// Show the host file before we sync (empty)
-	out, err := ioutil.ReadFile("/tmp/hosts")
-	if err != nil {
-		log.Fatal(err)
+	err := cmd(cfg, flags.Args()[1:])
+	if err == nil {
+		return exitOK
 	}
-	fmt.Printf("\n---- Before Sync() ----\n%s\n-----------------------\n", string(out))
 
-	// Write remaining contents to an io.Writer (still not in file, just in memory)
-	if _, err := hctl.Write(os.Stdout); err != nil {
-		log.Fatal(err)
+	var codeErr *exitCodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.code
 	}
 
-	// Sync the memory contents to disk
-	if _, err := hctl.Sync(); err != nil {
-		log.Fatal(err)
+	fmt.Fprintf(os.Stderr, "hostctl: %s\n", err)
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		flags.Usage()
+		return exitUsage
 	}
 
-	// Show the host file after we sync (empty)
-	out, err = ioutil.ReadFile("/tmp/hosts")
-	if err != nil {
-		log.Fatal(err)
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return exitConflict
 	}
-	fmt.Printf("\n---- After Sync() ----\n%s\n-----------------------\n", string(out))
+
+	return exitError
 }
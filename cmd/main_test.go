@@ -0,0 +1,353 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempHosts writes contents to a hosts file in a directory of its own, which
+// also holds its backups
+func tempHosts(t *testing.T, contents string) (string, func()) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "hostctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func readHosts(t *testing.T, path string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}
+
+func TestRun_RestoreDryRun(t *testing.T) {
+
+	original := "10.0.0.1\ta.internal\n"
+	path, cleanup := tempHosts(t, original)
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "-keep", "3", "add", "10.0.0.2", "b.internal"}); code != exitOK {
+		t.Fatalf("expecting add to succeed, got exit code %d", code)
+	}
+
+	backups, err := filepath.Glob(path + ".bak.*")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expecting one backup, got: %v, %v", backups, err)
+	}
+
+	edited := readHosts(t, path)
+	if code := run([]string{"-f", path, "-dry-run", "restore", backups[0]}); code != exitNoMatch {
+		t.Fatalf("expecting pending changes to be reported with exit code %d, got %d", exitNoMatch, code)
+	}
+
+	if contents := readHosts(t, path); contents != edited {
+		t.Fatalf("expecting -dry-run restore to leave the file alone, got: %q", contents)
+	}
+
+	if code := run([]string{"-f", path, "restore", backups[0]}); code != exitOK {
+		t.Fatalf("expecting restore to succeed, got exit code %d", code)
+	}
+
+	if contents := readHosts(t, path); contents != original {
+		t.Fatalf("expecting the backup to be restored, got: %q", contents)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "restore", backups[0]}); code != exitOK {
+		t.Fatalf("expecting no changes once restored, got exit code %d", code)
+	}
+}
+
+func TestRun_BackupDryRun(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\ta.internal\n")
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "-dry-run", "backup"}); code != exitUsage {
+		t.Fatalf("expecting -dry-run backup to be refused, got exit code %d", code)
+	}
+
+	if backups, err := filepath.Glob(path + ".bak.*"); err != nil || len(backups) != 0 {
+		t.Fatalf("expecting no backup to be taken, got: %v, %v", backups, err)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "backup", "-l"}); code != exitOK {
+		t.Fatalf("expecting backups to be listed, got exit code %d", code)
+	}
+}
+
+func TestRun_RmSelector(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\tads1.example.com\n\n10.0.0.2\tkeep.example.com\n10.0.0.3\tads2.example.com\n10.0.0.4\tads11.example.com\n")
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "rm", "-glob", "ads*1.example.com"}); code != exitOK {
+		t.Fatalf("expecting rm to succeed, got exit code %d", code)
+	}
+
+	expected := "\n10.0.0.2\tkeep.example.com\n10.0.0.3\tads2.example.com\n"
+	if contents := readHosts(t, path); contents != expected {
+		t.Fatalf("expecting %q, got: %q", expected, contents)
+	}
+
+	if code := run([]string{"-f", path, "rm", "-glob", "ads*1.example.com"}); code != exitNoMatch {
+		t.Fatalf("expecting no match once removed, got exit code %d", code)
+	}
+}
+
+func TestRun_FindFirst(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "# 10.0.0.5\tb.internal\n10.0.0.9\tb.internal\tb\n")
+	defer cleanup()
+
+	for _, selector := range [][]string{{"-host", "b.internal"}, {"-alias", "b"}, {"-ip", "10.0.0.9"}} {
+		if code := run(append([]string{"-f", path, "find", "-first"}, selector...)); code != exitOK {
+			t.Fatalf("%v: expecting the enabled entry to be found, got exit code %d", selector, code)
+		}
+	}
+
+	if code := run([]string{"-f", path, "find", "-first", "-ip", "10.0.0.5"}); code != exitNoMatch {
+		t.Fatalf("expecting a disabled entry not to resolve, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "find", "-first", "-glob", "b.*"}); code != exitUsage {
+		t.Fatalf("expecting -first to be refused with -glob, got exit code %d", code)
+	}
+}
+
+func TestRun_List(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\ta.internal\n")
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "list"}); code != exitOK {
+		t.Fatalf("expecting list to succeed, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "list", "-o", "xml"}); code != exitUsage {
+		t.Fatalf("expecting an unknown output format to be refused, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "nope"}); code != exitUsage {
+		t.Fatalf("expecting an unknown command to be refused, got exit code %d", code)
+	}
+
+	broken, cleanupBroken := tempHosts(t, "300.1.1.1\tbad.internal\n")
+	defer cleanupBroken()
+
+	if code := run([]string{"-f", broken, "list"}); code != exitError {
+		t.Fatalf("expecting an invalid hosts file to fail, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", broken, "-lenient", "list"}); code != exitOK {
+		t.Fatalf("expecting -lenient to list an invalid hosts file, got exit code %d", code)
+	}
+}
+
+func TestRun_Add(t *testing.T) {
+
+	original := "10.0.0.1   a.internal\n"
+	path, cleanup := tempHosts(t, original)
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "-dry-run", "add", "10.0.0.2", "b.internal"}); code != exitNoMatch {
+		t.Fatalf("expecting pending changes to be reported with exit code %d, got %d", exitNoMatch, code)
+	}
+
+	if contents := readHosts(t, path); contents != original {
+		t.Fatalf("expecting -dry-run add to leave the file alone, got: %q", contents)
+	}
+
+	if code := run([]string{"-f", path, "add", "-c", "db", "10.0.0.2", "b.internal", "b"}); code != exitOK {
+		t.Fatalf("expecting add to succeed, got exit code %d", code)
+	}
+
+	expected := original + "10.0.0.2\tb.internal\tb\t# db\n"
+	if contents := readHosts(t, path); contents != expected {
+		t.Fatalf("expecting %q, got: %q", expected, contents)
+	}
+
+	if code := run([]string{"-f", path, "add", "10.0.0.3"}); code != exitUsage {
+		t.Fatalf("expecting add without a hostname to be refused, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "add", "10.0.0.300", "c.internal"}); code != exitError {
+		t.Fatalf("expecting an invalid address to fail, got exit code %d", code)
+	}
+
+	if contents := readHosts(t, path); contents != expected {
+		t.Fatalf("expecting failed adds to leave the file alone, got: %q", contents)
+	}
+}
+
+func TestRun_Set(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\ta.internal\ta\t# web\n")
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "set", "A.internal", "10.0.0.9"}); code != exitOK {
+		t.Fatalf("expecting set to succeed, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "set", "b.internal", "10.0.0.2"}); code != exitOK {
+		t.Fatalf("expecting set to succeed, got exit code %d", code)
+	}
+
+	// The existing entry keeps its aliases and comment, a new hostname is appended
+	expected := "10.0.0.9\ta.internal\ta\t# web\n10.0.0.2\tb.internal\n"
+	if contents := readHosts(t, path); contents != expected {
+		t.Fatalf("expecting %q, got: %q", expected, contents)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "set", "a.internal", "10.0.0.9"}); code != exitOK {
+		t.Fatalf("expecting no changes when the address is already set, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "set", "a.internal"}); code != exitUsage {
+		t.Fatalf("expecting set without an address to be refused, got exit code %d", code)
+	}
+}
+
+func TestRun_Apply(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\ta.internal\n10.0.0.2\tb.internal\n")
+	defer cleanup()
+
+	spec := filepath.Join(filepath.Dir(path), "spec.yaml")
+	if err := ioutil.WriteFile(spec, []byte("- ip: 10.0.0.9\n  hostname: a.internal\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "apply", "-prune", spec}); code != exitNoMatch {
+		t.Fatalf("expecting pending changes to be reported with exit code %d, got %d", exitNoMatch, code)
+	}
+
+	if code := run([]string{"-f", path, "apply", "-prune", spec}); code != exitOK {
+		t.Fatalf("expecting apply to succeed, got exit code %d", code)
+	}
+
+	expected := "10.0.0.9\ta.internal\n"
+	if contents := readHosts(t, path); contents != expected {
+		t.Fatalf("expecting %q, got: %q", expected, contents)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "apply", "-prune", spec}); code != exitOK {
+		t.Fatalf("expecting no changes once applied, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "apply"}); code != exitUsage {
+		t.Fatalf("expecting apply without a spec to be refused, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "apply", spec + ".missing"}); code != exitError {
+		t.Fatalf("expecting a missing spec to fail, got exit code %d", code)
+	}
+}
+
+func TestRun_EnableDisable(t *testing.T) {
+
+	original := "10.0.0.1\ta.internal\n# BEGIN hostctl:staging\n10.0.0.5\tapi.internal\n# END hostctl:staging\n"
+	path, cleanup := tempHosts(t, original)
+	defer cleanup()
+
+	if code := run([]string{"-f", path, "disable", "staging"}); code != exitOK {
+		t.Fatalf("expecting disable to succeed, got exit code %d", code)
+	}
+
+	disabled := "10.0.0.1\ta.internal\n# BEGIN hostctl:staging\n# 10.0.0.5\tapi.internal\n# END hostctl:staging\n"
+	if contents := readHosts(t, path); contents != disabled {
+		t.Fatalf("expecting %q, got: %q", disabled, contents)
+	}
+
+	if code := run([]string{"-f", path, "-dry-run", "disable", "staging"}); code != exitOK {
+		t.Fatalf("expecting no changes once disabled, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "enable", "staging"}); code != exitOK {
+		t.Fatalf("expecting enable to succeed, got exit code %d", code)
+	}
+
+	if contents := readHosts(t, path); contents != original {
+		t.Fatalf("expecting %q, got: %q", original, contents)
+	}
+
+	if code := run([]string{"-f", path, "enable", "production"}); code != exitError {
+		t.Fatalf("expecting an unknown profile to fail, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "disable"}); code != exitUsage {
+		t.Fatalf("expecting disable without a profile to be refused, got exit code %d", code)
+	}
+}
+
+func TestRun_FmtDiff(t *testing.T) {
+
+	original := "10.0.0.1   A.Internal.\n"
+	path, cleanup := tempHosts(t, original)
+	defer cleanup()
+
+	for _, args := range [][]string{{"diff"}, {"-dry-run", "fmt"}} {
+		if code := run(append([]string{"-f", path}, args...)); code != exitNoMatch {
+			t.Fatalf("%v: expecting pending changes to be reported with exit code %d, got %d", args, exitNoMatch, code)
+		}
+
+		if contents := readHosts(t, path); contents != original {
+			t.Fatalf("%v: expecting the file to be left alone, got: %q", args, contents)
+		}
+	}
+
+	if code := run([]string{"-f", path, "fmt"}); code != exitOK {
+		t.Fatalf("expecting fmt to succeed, got exit code %d", code)
+	}
+
+	if contents := strings.TrimSpace(readHosts(t, path)); contents != "10.0.0.1\ta.internal" {
+		t.Fatalf("expecting the entry in canonical form, got: %q", contents)
+	}
+
+	if code := run([]string{"-f", path, "diff"}); code != exitOK {
+		t.Fatalf("expecting no changes once formatted, got exit code %d", code)
+	}
+
+	if code := run([]string{"-f", path, "diff", "-x"}); code != exitUsage {
+		t.Fatalf("expecting an unknown flag to be refused, got exit code %d", code)
+	}
+}
+
+func TestRun_Lint(t *testing.T) {
+
+	for _, tc := range []struct {
+		contents string
+		code     int
+	}{
+		{"10.0.0.1\ta.internal\n10.0.0.2\tb.internal\n", exitOK},
+		{"10.0.0.1\ta.internal\n10.0.0.2\ta.internal\n", exitNoMatch},
+		{"300.1.1.1\tbad.internal\n10.0.0.1\ta.internal\n", exitNoMatch},
+		{"# BEGIN hostctl:staging\n10.0.0.5\tapi.internal\n", exitNoMatch},
+	} {
+		path, cleanup := tempHosts(t, tc.contents)
+
+		if code := run([]string{"-f", path, "lint"}); code != tc.code {
+			cleanup()
+			t.Fatalf("%q: expecting exit code %d, got %d", tc.contents, tc.code, code)
+		}
+
+		if contents := readHosts(t, path); contents != tc.contents {
+			cleanup()
+			t.Fatalf("%q: expecting lint to leave the file alone, got: %q", tc.contents, contents)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,53 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRun_Conflict(t *testing.T) {
+
+	path, cleanup := tempHosts(t, "10.0.0.1\ta.internal\n")
+	defer cleanup()
+
+	// A shared lock lets add load the file but keeps its Sync waiting
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"-f", path, "-lock-timeout", "10s", "add", "10.0.0.2", "b.internal"})
+	}()
+
+	// Edit the file in place, as another editor would, once add has loaded it
+	time.Sleep(200 * time.Millisecond)
+	edited := "10.0.0.1\ta.internal\n10.0.0.3\tc.internal\n"
+	if err := ioutil.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_UN); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := <-done; code != exitConflict {
+		t.Fatalf("expecting a conflict to be reported with exit code %d, got %d", exitConflict, code)
+	}
+
+	if contents := readHosts(t, path); contents != edited {
+		t.Fatalf("expecting the other change to be kept, got: %q", contents)
+	}
+}
@@ -0,0 +1,267 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	diffContext  = 3
+	diffMaxEdits = 4096
+)
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// splitLines splits contents into lines keeping their line endings
+func splitLines(contents []byte) []string {
+	lines := strings.SplitAfter(string(contents), "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edit script turning a into b using Myers' algorithm,
+// anything needing more than diffMaxEdits edits is replaced as a whole
+func diffLines(a, b []string) []diffOp {
+
+	// Common prefix and suffix never need to be searched
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+func myers(a, b []string) []diffOp {
+
+	n, m := len(a), len(b)
+	max := n + m
+	if max > diffMaxEdits {
+		max = diffMaxEdits
+	}
+
+	// trace[d] holds the furthest x reached on every diagonal k (offset by d) after d edits
+	trace := make([][]int, 0)
+	v := map[int]int{1: 0}
+	for d := 0; d <= max; d++ {
+
+		current := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[k] = x
+			current[k+d] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, current)
+				return backtrack(trace, a, b)
+			}
+		}
+
+		trace = append(trace, current)
+	}
+
+	// Too many edits, replace everything
+	ops := make([]diffOp, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+func backtrack(trace [][]int, a, b []string) []diffOp {
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+
+		k := x - y
+		previous := trace[d-1]
+		at := func(k int) int {
+			return previous[k+d-1]
+		}
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff renders the changes turning a into b in unified diff format, it
+// is empty if there are none
+func unifiedDiff(fromName, toName string, a, b []byte) string {
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	buf := bytes.NewBuffer(nil)
+	for start := 0; start < len(ops); {
+
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := start
+		for n := start; n < len(ops); n++ {
+			if ops[n].kind != ' ' {
+				end = n + 1
+			} else if n-end >= 2*diffContext {
+				break
+			}
+		}
+
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+
+		last := end + diffContext
+		if last > len(ops) {
+			last = len(ops)
+		}
+
+		if buf.Len() == 0 {
+			fmt.Fprintf(buf, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		// Line numbers of the first hunk line in a and b
+		aLine, bLine := 1, 1
+		for _, op := range ops[:first] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[first:last] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, op := range ops[first:last] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = last
+	}
+
+	return buf.String()
+}
+
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// Diff returns a unified diff from the hosts file on disk to what Sync would
+// write, it is empty when there are no pending changes
+func (hfc *hostsFileCtl) Diff() (string, error) {
+
+	unlock, err := hfc.lock(false)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	current, err := ioutil.ReadFile(hfc.hostsFile)
+	if err != nil {
+		return "", err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := hfc.Write(buf); err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(hfc.hostsFile, hfc.hostsFile, current, buf.Bytes()), nil
+}
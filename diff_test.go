@@ -0,0 +1,78 @@
+package go_hostctl
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+
+	a := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\n")
+	b := []byte("a\nb\nc\nd\nE\nf\ng\nh\ni\nj")
+
+	expected := `--- old
++++ new
+@@ -2,8 +2,9 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
++j
+\ No newline at end of file
+`
+	if diff := unifiedDiff("old", "new", a, b); diff != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, diff)
+	}
+
+	if diff := unifiedDiff("old", "new", a, a); diff != "" {
+		t.Fatalf("expecting no diff for identical contents, got:\n%s", diff)
+	}
+}
+
+func TestHostsFileCtl_Diff(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_Diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString("127.0.0.1 localhost\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := hctl.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff != "" {
+		t.Fatalf("expecting no pending changes, got:\n%s", diff)
+	}
+
+	if err := hctl.Add(*hostEntry1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = hctl.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "--- " + f.Name() + "\n+++ " + f.Name() + "\n@@ -1 +1,2 @@\n 127.0.0.1 localhost\n+" + hostEntry1.String() + "\n"
+	if diff != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, diff)
+	}
+}
@@ -1,3 +1,10 @@
 module github.com/zeronopbot/go-hostctl
 
-go 1.13
+go 1.17
+
+require (
+	golang.org/x/net v0.11.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/text v0.10.0 // indirect
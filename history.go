@@ -0,0 +1,154 @@
+package go_hostctl
+
+import "errors"
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// OperationKind is the kind of an edit recorded in the history
+type OperationKind string
+
+const (
+	OpAdd    OperationKind = "add"
+	OpDelete OperationKind = "delete"
+	OpRead   OperationKind = "read"
+	OpUpdate OperationKind = "update"
+	OpTx     OperationKind = "transaction"
+)
+
+// Operation is an edit recorded in the history. Entries holds the added,
+// deleted or read entries, for an update the previous entry followed by the
+// new one. A delete of several positions holds every deleted entry and the
+// position of the first one. A committed transaction holds its operations in
+// Operations and is undone and redone as a whole. Undone operations can be
+// redone.
+type Operation struct {
+	Kind       OperationKind
+	Position   int
+	Entries    []HostEntry
+	Operations []Operation
+	Undone     bool
+}
+
+// change is a recorded operation along with how to apply and revert it
+type change struct {
+	op   Operation
+	do   func()
+	undo func()
+}
+
+// record applies the change and adds it to the history, anything undone so
+// far can no longer be redone. The write lock must be held.
+func (hfc *hostsFileCtl) record(c change) {
+	c.do()
+	hfc.undo = append(hfc.undo, c)
+	hfc.redo = nil
+}
+
+// group turns the changes recorded since the history had from entries into a
+// single transaction change, the write lock must be held
+func (hfc *hostsFileCtl) group(from int) {
+
+	changes := append([]change{}, hfc.undo[from:]...)
+	if len(changes) == 0 {
+		return
+	}
+
+	op := Operation{Kind: OpTx, Position: changes[0].op.Position}
+	for _, c := range changes {
+		op.Operations = append(op.Operations, c.op)
+	}
+
+	hfc.undo = append(hfc.undo[:from:from], change{
+		op: op,
+		do: func() {
+			for _, c := range changes {
+				c.do()
+			}
+		},
+		undo: func() {
+			for n := len(changes) - 1; n >= 0; n-- {
+				changes[n].undo()
+			}
+		},
+	})
+}
+
+// forget clears the history before an edit that cannot be undone, the write lock must be held
+func (hfc *hostsFileCtl) forget() {
+	hfc.undo = nil
+	hfc.redo = nil
+}
+
+// Undo reverts the last Add, Delete, Update or Read that was not undone yet.
+// Other edits, such as Apply, Move, managed blocks, profiles or reloading the
+// file, cannot be undone and clear the history.
+func (hfc *hostsFileCtl) Undo() error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	if len(hfc.undo) == 0 {
+		return ErrNothingToUndo
+	}
+
+	c := hfc.undo[len(hfc.undo)-1]
+	c.undo()
+
+	hfc.undo = hfc.undo[:len(hfc.undo)-1]
+	hfc.redo = append(hfc.redo, c)
+	return nil
+}
+
+// Redo applies the last undone operation again
+func (hfc *hostsFileCtl) Redo() error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	if len(hfc.redo) == 0 {
+		return ErrNothingToRedo
+	}
+
+	c := hfc.redo[len(hfc.redo)-1]
+	c.do()
+
+	hfc.redo = hfc.redo[:len(hfc.redo)-1]
+	hfc.undo = append(hfc.undo, c)
+	return nil
+}
+
+// History returns the recorded operations oldest first followed by the
+// undone ones in the order Redo applies them
+func (hfc *hostsFileCtl) History() []Operation {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	history := make([]Operation, 0, len(hfc.undo)+len(hfc.redo))
+	for _, c := range hfc.undo {
+		history = append(history, c.op.copy())
+	}
+
+	for n := len(hfc.redo) - 1; n >= 0; n-- {
+		op := hfc.redo[n].op.copy()
+		op.Undone = true
+		history = append(history, op)
+	}
+
+	return history
+}
+
+func (op Operation) copy() Operation {
+	op.Entries = append([]HostEntry{}, op.Entries...)
+	if op.Operations != nil {
+		operations := make([]Operation, len(op.Operations))
+		for n, child := range op.Operations {
+			operations[n] = child.copy()
+		}
+		op.Operations = operations
+	}
+	return op
+}
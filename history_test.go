@@ -0,0 +1,145 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func written(t *testing.T, hctl HostFileCtl) string {
+	buf := &bytes.Buffer{}
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestHostsFileCtl_UndoRedo(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := []string{written(t, hctl)}
+	entries := [][]HostEntry{hctl.Entries()}
+
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+
+		entry, err := NewHostEntry(fmt.Sprintf("10.0.0.%d", n%250), fmt.Sprintf("host%d", n), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch rnd.Intn(4) {
+		case 0:
+			err = hctl.Add(*entry, rnd.Intn(len(hctl.Entries())+1)-1)
+		case 1:
+			err = hctl.Delete(rnd.Intn(len(hctl.Entries())+1) - 1)
+		case 2:
+			err = hctl.Update(rnd.Intn(len(hctl.Entries())), *entry)
+		case 3:
+			err = hctl.Read(strings.NewReader(fmt.Sprintf("\n%s   %s-read\n\n", entry.IPAddress, entry.Hostname)))
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		states = append(states, written(t, hctl))
+		entries = append(entries, hctl.Entries())
+	}
+
+	if len(hctl.History()) != 200 {
+		t.Fatalf("expecting 200 operations in the history, got: %d", len(hctl.History()))
+	}
+
+	for n := len(states) - 2; n >= 0; n-- {
+		if err := hctl.Undo(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := written(t, hctl); got != states[n] {
+			t.Fatalf("undo to state %d, expecting:\n%s\ngot:\n%s", n, states[n], got)
+		}
+
+		if !reflect.DeepEqual(hctl.Entries(), entries[n]) {
+			t.Fatalf("undo to state %d, mismatch entries", n)
+		}
+	}
+
+	if err := hctl.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expecting ErrNothingToUndo, got: %v", err)
+	}
+
+	for n := 1; n < len(states); n++ {
+		if err := hctl.Redo(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := written(t, hctl); got != states[n] {
+			t.Fatalf("redo to state %d, expecting:\n%s\ngot:\n%s", n, states[n], got)
+		}
+
+		if !reflect.DeepEqual(hctl.Entries(), entries[n]) {
+			t.Fatalf("redo to state %d, mismatch entries", n)
+		}
+	}
+
+	if err := hctl.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("expecting ErrNothingToRedo, got: %v", err)
+	}
+}
+
+func TestHostsFileCtl_History(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hctl.History()) != 0 {
+		t.Fatalf("expecting no history after loading, got: %v", hctl.History())
+	}
+
+	if err := hctl.Add(*hostEntry1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Delete(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	history := hctl.History()
+	if len(history) != 2 || history[0].Kind != OpAdd || history[0].Undone || history[0].Entries[0].Hostname != "host_one" ||
+		history[1].Kind != OpDelete || !history[1].Undone || history[1].Position != len(hctl.Entries())-1 {
+		t.Fatalf("unexpected history: %v", history)
+	}
+
+	// A new edit drops what was undone
+	if err := hctl.Add(*hostEntry2, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Fatalf("expecting ErrNothingToRedo, got: %v", err)
+	}
+
+	// Edits that are not recorded clear the history
+	if err := hctl.Move(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("expecting ErrNothingToUndo, got: %v", err)
+	}
+}
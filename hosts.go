@@ -3,23 +3,31 @@ package go_hostctl
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
-	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
+	// RegexPatternName matches the characters PermissiveNames allows.
+	//
+	// Deprecated: names are no longer matched with a regular expression, use
+	// PermissiveNames or IsValidName to check a name.
 	RegexPatternName       = "^[a-zA-Z0-9\\.\\-_]*$"
 	CarriageReturnLineFeed = "\r\n"
+	LineFeed               = "\n"
+	MaxLineLength          = 4096
 )
 
 var (
-	nameMatcher = regexp.MustCompile(RegexPatternName)
+	ErrNotFound = errors.New("no matching entry")
 )
 
 func tokenize(line []byte) ([]string, string, error) {
@@ -71,11 +79,9 @@ func IsComment(item string) bool {
 	return strings.HasPrefix(Normalize(&item), "#")
 }
 
+// IsValidName reports if the name is accepted by PermissiveNames
 func IsValidName(name string) bool {
-	if len(name) <= 0 {
-		return false
-	}
-	return len(nameMatcher.FindStringSubmatch(Normalize(&name))) > 0
+	return validatePermissive(name) == nil
 }
 
 func IsValidIP(ip net.IP) bool {
@@ -107,18 +113,39 @@ func IsValidAliases(aliases []string) bool {
 	return true
 }
 
+// lineSource records how an entry appeared in the file it was read from so
+// it can be written back byte-for-byte when lossless mode is enabled
+type lineSource struct {
+	leading   []byte // blank lines preceding the entry, verbatim
+	raw       []byte // the line as read without its line ending
+	eol       []byte // the line ending as read, empty on a final unterminated line
+	canonical []byte // the rendered form of the entry when it was read
+}
+
 type HostEntry struct {
 	rawLine   []byte
 	isComment bool
+	unparsed  bool
+	mapped    bool
+	source    *lineSource
+	id        EntryID
 	Position  int
 	Comment   string
 	IPAddress net.IP
+	Zone      string // IPv6 zone identifier, such as eth0 in fe80::1%eth0
 	Hostname  string
 	Aliases   []string
+	Disabled  bool
 }
 
 func (he *HostEntry) Validate() error {
 
+	// Lines kept by lenient mode are written back as they were read
+	if he.unparsed {
+		he.isComment = true
+		return nil
+	}
+
 	he.isComment = false
 	if he.Aliases == nil {
 		he.Aliases = make([]string, 0)
@@ -129,8 +156,8 @@ func (he *HostEntry) Validate() error {
 		return nil
 	}
 
-	if he.IPAddress != nil && IsComment(he.IPAddress.String()) {
-		return fmt.Errorf("ip address cannot be a comment: %s", he.IPAddress.String())
+	if he.IPAddress != nil && IsComment(he.ipString()) {
+		return fmt.Errorf("ip address cannot be a comment: %s", he.ipString())
 	}
 
 	if IsComment(he.Hostname) {
@@ -155,31 +182,51 @@ func (he *HostEntry) Validate() error {
 		return fmt.Errorf("no valid ip address parsed: %v", he)
 	}
 
-	// Non comment line should have at least a domain name
-	if !IsValidName(Normalize(&he.Hostname)) {
-		return fmt.Errorf("entry must have a hostname if ip address is set")
+	if err := he.validateZone(); err != nil {
+		return err
+	}
+
+	// Non comment line should have at least a domain name, internationalized
+	// names are kept in their punycode form
+	hostname, err := checkName(Normalize(&he.Hostname))
+	if err != nil {
+		return fmt.Errorf("hostname: %w", err)
 	}
+	he.Hostname = hostname
 
 	// Cleanup and set aliases
 	aliases := make([]string, len(he.Aliases))
 	for n, alias := range he.Aliases {
-		aliases[n] = Normalize(&alias)
+		if aliases[n], err = checkName(Normalize(&alias)); err != nil {
+			return fmt.Errorf("alias %d: %w", n+1, err)
+		}
 	}
 
 	he.Aliases = aliases
+	he.format()
+	return nil
+}
+
+// format sets the raw line of a valid entry
+func (he *HostEntry) format() {
+
+	aliases := he.Aliases
 
 	// Setup the raw line based on what is provided and valid
 	if IsComment(he.Comment) && len(aliases) > 0 {
-		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s\t%s", he.IPAddress.String(), he.Hostname, strings.Join(aliases, " "), he.Comment))
+		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s\t%s", he.ipString(), he.Hostname, strings.Join(aliases, " "), he.Comment))
 	} else if IsComment(he.Comment) {
-		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s", he.IPAddress.String(), he.Hostname, he.Comment))
+		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s", he.ipString(), he.Hostname, he.Comment))
 	} else if len(he.Aliases) > 0 {
-		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s", he.IPAddress.String(), he.Hostname, strings.Join(aliases, " ")))
+		he.rawLine = []byte(fmt.Sprintf("%s\t%s\t%s", he.ipString(), he.Hostname, strings.Join(aliases, " ")))
 	} else {
-		he.rawLine = []byte(fmt.Sprintf("%s\t%s", he.IPAddress.String(), he.Hostname))
+		he.rawLine = []byte(fmt.Sprintf("%s\t%s", he.ipString(), he.Hostname))
 	}
 
-	return nil
+	// Disabled entries are commented out but keep their data
+	if he.Disabled {
+		he.rawLine = append([]byte("# "), he.rawLine...)
+	}
 }
 
 func (he *HostEntry) Write(writer io.Writer) (int, error) {
@@ -190,6 +237,28 @@ func (he *HostEntry) Write(writer io.Writer) (int, error) {
 	return writer.Write(he.rawLine)
 }
 
+// render returns the canonical form of the entry without modifying it
+func (he *HostEntry) render() ([]byte, error) {
+	tmp := *he
+	if err := tmp.Validate(); err != nil {
+		return nil, err
+	}
+	return tmp.rawLine, nil
+}
+
+// leading returns the blank lines read in front of the entry
+func (he *HostEntry) leading() []byte {
+	if he.source == nil {
+		return nil
+	}
+	return he.source.leading
+}
+
+// unchanged reports if the entry still renders as it did when it was read
+func (he *HostEntry) unchanged(rendered []byte) bool {
+	return he.source != nil && he.source.raw != nil && bytes.Equal(rendered, he.source.canonical)
+}
+
 func (he *HostEntry) String() string {
 	return string(he.rawLine)
 }
@@ -209,6 +278,13 @@ func ParseHostEntryLine(line []byte) (*HostEntry, error) {
 		return nil, fmt.Errorf("no tokens parsed for line: '%s'", line)
 	}
 
+	// A commented out entry is a disabled entry rather than a plain comment
+	if strings.HasPrefix(tokens[0], "#") {
+		if entry, ok := parseDisabledEntry(tokens[0]); ok {
+			return entry, nil
+		}
+	}
+
 	hostEntry := &HostEntry{
 		rawLine: []byte(rawLine),
 		Aliases: make([]string, 0),
@@ -222,35 +298,87 @@ func ParseHostEntryLine(line []byte) (*HostEntry, error) {
 		if strings.HasPrefix(token, "#") {
 			hostEntry.Comment = strings.Join(tokens[n:], " ")
 			hostEntry.isComment = n == 0 // only a comment line IF its the first token
-			return hostEntry, nil
+			if hostEntry.isComment {
+				return hostEntry, nil
+			}
+			break
 		}
 
 		switch n {
 
 		// IP Address
 		case 0:
-			hostEntry.IPAddress = net.ParseIP(tok)
+			hostEntry.IPAddress, hostEntry.Zone, hostEntry.mapped = parseAddress(tok)
 			if hostEntry.IPAddress == nil {
-				return nil, fmt.Errorf("invalid ip address: %s", tok)
+				return nil, &fieldError{field: n, err: fmt.Errorf("invalid ip address: %s", tok)}
 			}
 
 		// Hostname
 		case 1:
-			if !IsValidName(tok) {
-				return nil, fmt.Errorf("not a valid hostname: %s", tok)
+			if tok, err = checkName(tok); err != nil {
+				return nil, &fieldError{field: n, err: fmt.Errorf("hostname: %w", err)}
 			}
 			hostEntry.Hostname = tok
 
 		// Aliases
 		default:
-			if !IsValidName(tok) {
-				return nil, fmt.Errorf("not a valid alias: %s", tok)
+			if tok, err = checkName(tok); err != nil {
+				return nil, &fieldError{field: n, err: fmt.Errorf("alias %d: %w", n-1, err)}
 			}
 			hostEntry.Aliases = append(hostEntry.Aliases, tok)
 		}
 	}
 
-	return hostEntry, hostEntry.Validate()
+	// Names are converted and validated above, only the rest is left to check
+	if len(hostEntry.Hostname) == 0 {
+		return nil, &fieldError{field: 1, err: fmt.Errorf("hostname: %w", validatePermissive(""))}
+	}
+
+	if err := hostEntry.validateZone(); err != nil {
+		return nil, err
+	}
+
+	hostEntry.format()
+	return hostEntry, nil
+}
+
+// parseDisabledEntry parses a comment line holding a commented out entry such
+// as '# 10.0.0.1<tab>api.internal'. Only comments written exactly as a disabled
+// entry is written are taken as one, so prose like '# 10.0.0.1 is the router'
+// stays a comment.
+func parseDisabledEntry(comment string) (*HostEntry, bool) {
+
+	body := strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	if len(body) == 0 || strings.HasPrefix(body, "#") {
+		return nil, false
+	}
+
+	if ip, _, _ := parseAddress(strings.Fields(body)[0]); ip == nil {
+		return nil, false
+	}
+
+	entry, err := ParseHostEntryLine([]byte(body))
+	if err != nil || entry.isComment {
+		return nil, false
+	}
+
+	entry.Disabled = true
+	if err := entry.Validate(); err != nil {
+		return nil, false
+	}
+
+	return entry, string(entry.rawLine) == strings.TrimSpace(comment)
+}
+
+// commentLine returns the comment line entry for a line starting with '#'
+func commentLine(line []byte) *HostEntry {
+	tokens, rawLine, _ := tokenize(line)
+	return &HostEntry{
+		rawLine:   []byte(rawLine),
+		isComment: true,
+		Comment:   strings.Join(tokens, " "),
+		Aliases:   make([]string, 0),
+	}
 }
 
 func NewHostEntry(ipaddr, hostname, comment string, aliases ...string) (*HostEntry, error) {
@@ -260,103 +388,375 @@ func NewHostEntry(ipaddr, hostname, comment string, aliases ...string) (*HostEnt
 	}
 
 	entry := &HostEntry{
-		Comment:   comment,
-		IPAddress: net.ParseIP(ipaddr),
-		Hostname:  hostname,
-		Aliases:   aliases,
+		Comment:  comment,
+		Hostname: hostname,
+		Aliases:  aliases,
 	}
+	entry.IPAddress, entry.Zone, entry.mapped = parseAddress(ipaddr)
 
 	return entry, entry.Validate()
 }
 
 type HostFileCtl interface {
 	Delete(position int) error
+	DeletePositions(positions ...int) error
 	Add(entry HostEntry, position int) error
 	GetIP(ip string) ([]HostEntry, error)
 	GetAlias(alias string) ([]HostEntry, error)
 	GetHostname(hostname string) ([]HostEntry, error)
+	Update(position int, entry HostEntry) error
+	Move(from, to int) error
+	Upsert(hostname, ip string, aliases ...string) (HostEntry, error)
+	Begin() *Tx
+	Undo() error
+	Redo() error
+	History() []Operation
+	GetID(id EntryID) (HostEntry, error)
+	DeleteID(id EntryID) error
+	UpdateID(id EntryID, entry HostEntry) error
+	MoveID(id EntryID, position int) error
+	GetRange(query string) ([]HostEntry, error)
+	FindNames(query NameQuery) ([]NameMatch, error)
+	Duplicates() []Duplicate
+	GetFirstIP(ip string) (HostEntry, error)
+	GetFirstAlias(alias string) (HostEntry, error)
+	GetFirstHostname(hostname string) (HostEntry, error)
+	Resolve(name string) (HostEntry, error)
 	Write(writer io.Writer) (int, error)
 	Read(reader io.Reader) error
 	Sync() (int, error)
 	Entries() []HostEntry
+	Block(name string) ([]HostEntry, error)
+	ReplaceBlock(name string, entries []HostEntry) error
+	RemoveBlock(name string) error
+	Profiles() ([]Profile, error)
+	EnableProfile(name string) error
+	DisableProfile(name string) error
+	Rebase() error
+	Backup() (Backup, error)
+	Backups() ([]Backup, error)
+	Restore(backup string) error
+	DiffBackup(backup string) (string, error)
+	Apply(desired []HostEntry, prune bool) ([]Change, error)
+	Diff() (string, error)
+	Diagnostics() []Diagnostic
 }
 
 type hostsFileCtl struct {
 	rwLck     *sync.RWMutex
 	hostsFile string
 	entries   []HostEntry
+	lossless  bool
+	eol       []byte
+	trailing  []byte
+
+	mappedEqual   bool
+	preserveCase  bool
+	nameValidator NameValidator
+
+	// Keep lines that cannot be parsed and report them as diagnostics
+	lenient     bool
+	diagnostics []Diagnostic
+
+	// Lookup index, nil when it has to be rebuilt
+	index    *entryIndex
+	indexLck sync.Mutex
+
+	// Last entry id handed out
+	lastID EntryID
+
+	// Operations that can be undone and redone
+	undo []change
+	redo []change
+
+	lockFile    string
+	lockTimeout time.Duration
+
+	backupDir  string
+	backupKeep int
+
+	// Entries and content hash of the hosts file as last loaded or synced
+	base       []HostEntry
+	loadedHash [sha256.Size]byte
+}
+
+// Option configures the optional behaviour of a HostFileCtl
+type Option func(hfc *hostsFileCtl) error
+
+// WithLossless keeps the original formatting (whitespace, blank lines and line
+// endings) of every line that is not added or modified so writing the entries
+// back only changes the lines that were actually edited
+func WithLossless() Option {
+	return func(hfc *hostsFileCtl) error {
+		hfc.lossless = true
+		return nil
+	}
+}
+
+func NewHostFileCtl(hostFilePath string, opts ...Option) (HostFileCtl, error) {
+
+	htctl := &hostsFileCtl{
+		rwLck:       new(sync.RWMutex),
+		hostsFile:   hostFilePath,
+		entries:     make([]HostEntry, 0),
+		lockTimeout: DefaultLockTimeout,
+	}
+
+	for _, opt := range opts {
+		if err := opt(htctl); err != nil {
+			return nil, err
+		}
+	}
+
+	snap, err := htctl.load()
+	if err != nil {
+		return nil, err
+	}
+
+	htctl.reset(snap)
+	return htctl, nil
 }
 
-func NewHostFileCtl(hostFilePath string) (HostFileCtl, error) {
+// load parses the hosts file, creating it if missing, under a shared lock
+func (hfc *hostsFileCtl) load() (*snapshot, error) {
 
 	// Get existing file mode
 	mode := os.FileMode(0644)
-	if stat, err := os.Stat(hostFilePath); err == nil {
+	if stat, err := os.Stat(hfc.hostsFile); err == nil {
 		mode = stat.Mode()
 	}
 
+	unlock, err := hfc.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	// Only need to read here
-	f, err := os.OpenFile(hostFilePath, os.O_CREATE | os.O_RDONLY | os.O_SYNC, mode)
+	f, err := os.OpenFile(hfc.hostsFile, os.O_CREATE | os.O_RDONLY | os.O_SYNC, mode)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	rdr := bufio.NewReader(f)
+	contents, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
 
-	htctl := &hostsFileCtl{
-		rwLck:     new(sync.RWMutex),
-		hostsFile: hostFilePath,
-		entries:   make([]HostEntry, 0),
+	entries, trailing, eol, diagnostics, err := hfc.parse(bufio.NewReader(bytes.NewReader(contents)), nil, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	return htctl, htctl.read(rdr)
+	return &snapshot{
+		entries:     entries,
+		trailing:    trailing,
+		eol:         eol,
+		diagnostics: diagnostics,
+		hash:        sha256.Sum256(contents),
+	}, nil
+}
+
+// splitLineEnding separates a line read up to and including '\n' from its line ending
+func splitLineEnding(raw []byte) ([]byte, []byte) {
+	if bytes.HasSuffix(raw, []byte(CarriageReturnLineFeed)) {
+		return raw[:len(raw)-2], raw[len(raw)-2:]
+	}
+	if bytes.HasSuffix(raw, []byte(LineFeed)) {
+		return raw[:len(raw)-1], raw[len(raw)-1:]
+	}
+	return raw, nil
 }
 
 func (hfc *hostsFileCtl) read(rdr *bufio.Reader) error {
 
+	// Blank lines left over at the end of a previous read lead the first new entry
+	entries, trailing, eol, diagnostics, err := hfc.parse(rdr, hfc.trailing, hfc.eol)
+	if err != nil {
+		return err
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	if !hfc.lossless {
+		trailing, eol = hfc.trailing, hfc.eol
+	}
+
+	count, prevTrailing, prevEOL := len(hfc.entries), hfc.trailing, hfc.eol
+	reported := len(hfc.diagnostics)
+	for n := range entries {
+		entries[n].Position = count + n
+		hfc.assignID(&entries[n])
+	}
+
+	hfc.record(change{
+		op: Operation{Kind: OpRead, Position: count, Entries: entries},
+		do: func() {
+			hfc.trailing, hfc.eol = trailing, eol
+			hfc.diagnostics = append(hfc.diagnostics[:reported:reported], diagnostics...)
+			hfc.appendEntries(entries...)
+		},
+		undo: func() {
+			hfc.trailing, hfc.eol = prevTrailing, prevEOL
+			hfc.diagnostics = hfc.diagnostics[:reported]
+			hfc.entries = hfc.entries[:count]
+			hfc.index = nil
+		},
+	})
+
+	return nil
+}
+
+// parse reads all entries from rdr, leading holds blank lines that precede the
+// first entry and eol the line ending used so far. It returns the entries, the
+// blank lines after the last entry and the line ending used by the file. In
+// lenient mode lines that cannot be parsed are kept as unparsed entries and
+// reported as diagnostics.
+func (hfc *hostsFileCtl) parse(rdr *bufio.Reader, leading, eol []byte) ([]HostEntry, []byte, []byte, []Diagnostic, error) {
+
 	entries := make([]HostEntry, 0)
+	diagnostics := make([]Diagnostic, 0)
+
 	var lineNumber int
 readLoop:
 	for {
 
-		line, prefix, err := rdr.ReadLine()
-		if prefix {
-			return fmt.Errorf("line is too long: %d", lineNumber)
+		raw, err := rdr.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, nil, nil, err
 		}
 
-		if err != nil {
-			if err == io.EOF {
-				break readLoop
-			}
-			return err
+		if len(raw) == 0 {
+			break readLoop
+		}
+
+		lineNumber++
+		line, lineEnding := splitLineEnding(raw)
+
+		if eol == nil && lineEnding != nil {
+			eol = lineEnding
 		}
 
 		// Skip newlines
-		if len(line) <= 0 {
-			lineNumber++
+		if len(bytes.TrimSpace(line)) <= 0 {
+			if hfc.lossless {
+				leading = append(append([]byte{}, leading...), raw...)
+			}
 			continue
 		}
 
-		entry, err := ParseHostEntryLine(line)
+		entry, err := hfc.parseLine(line)
 		if err != nil {
-			return fmt.Errorf("invalid host entry on line %d - %s", lineNumber, err)
+			if !hfc.lenient {
+				return nil, nil, nil, nil, fmt.Errorf("invalid host entry on line %d - %s", lineNumber, err)
+			}
+
+			diagnostics = append(diagnostics, diagnose(line, lineNumber, err))
+			entry = unparsedLine(line)
 		}
 
-		lineNumber++
+		if hfc.lossless {
+			canonical, err := hfc.renderParsed(*entry)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("invalid host entry on line %d - %s", lineNumber, err)
+			}
+
+			entry.source = &lineSource{
+				leading:   leading,
+				raw:       append([]byte{}, line...),
+				eol:       append([]byte{}, lineEnding...),
+				canonical: canonical,
+			}
+		}
+		leading = nil
+
 		entries = append(entries, *entry)
 	}
 
-	// Update existing and positions
-	hfc.entries = append(hfc.entries, entries ...)
-	hfc.updatePosition()
-	return nil
+	return entries, leading, eol, diagnostics, nil
+}
+
+// parseLine parses a non blank line and checks its names
+func (hfc *hostsFileCtl) parseLine(line []byte) (*HostEntry, error) {
+
+	if len(line) > MaxLineLength {
+		return nil, fmt.Errorf("line is too long: %d bytes, the limit is %d", len(line), MaxLineLength)
+	}
+
+	entry, err := ParseHostEntryLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	// ParseHostEntryLine already checked the names with PermissiveNames
+	if hfc.nameValidator == nil {
+		return entry, nil
+	}
+
+	if err := hfc.validateNames(entry); err != nil {
+		// A commented out line with names the validator rejects is just a comment
+		if !entry.Disabled {
+			return nil, err
+		}
+		entry = commentLine(line)
+	}
+
+	return entry, nil
+}
+
+// renderParsed returns how a parsed entry is written, entries are already
+// validated so only comment lines go through Validate again
+func (hfc *hostsFileCtl) renderParsed(entry HostEntry) ([]byte, error) {
+
+	output := hfc.output(entry)
+	if output.isComment {
+		return output.render()
+	}
+
+	output.format()
+	return output.rawLine, nil
+}
+
+// keepLeading hands the blank lines in front of the entry at first over to the
+// entry that follows last (or the end of the file) before the range is removed
+func (hfc *hostsFileCtl) keepLeading(first, last int) {
+
+	src := hfc.entries[first].source
+	if src == nil || len(src.leading) == 0 {
+		return
+	}
+
+	if last == len(hfc.entries)-1 {
+		hfc.trailing = append(append([]byte{}, src.leading...), hfc.trailing...)
+		return
+	}
+
+	next := &hfc.entries[last+1]
+	var nextLeading []byte
+	if next.source != nil {
+		nextLeading = next.source.leading
+	}
+	next.source = withLeading(next.source, append(append([]byte{}, src.leading...), nextLeading...))
+}
+
+// withLeading returns a copy of src with the given leading blank lines
+func withLeading(src *lineSource, leading []byte) *lineSource {
+	tmp := lineSource{}
+	if src != nil {
+		tmp = *src
+	}
+	tmp.leading = leading
+	return &tmp
 }
 
 func (hfc *hostsFileCtl) updatePosition() {
 	for n, _ := range hfc.entries {
 		hfc.entries[n].Position = n
+		hfc.assignID(&hfc.entries[n])
 	}
+	hfc.index = nil
 }
 
 func (hfc *hostsFileCtl) Delete(position int) error {
@@ -368,6 +768,12 @@ func (hfc *hostsFileCtl) Delete(position int) error {
 	hfc.rwLck.Lock()
 	defer hfc.rwLck.Unlock()
 
+	return hfc.delete(position)
+}
+
+// delete removes the entry at position, the write lock must be held
+func (hfc *hostsFileCtl) delete(position int) error {
+
 	if position >= len(hfc.entries) {
 		return fmt.Errorf("postion out of range: %d", position)
 	}
@@ -376,29 +782,143 @@ func (hfc *hostsFileCtl) Delete(position int) error {
 		return nil
 	}
 
-	defer hfc.updatePosition()
+	if position == -1 {
+		position = len(hfc.entries) - 1
+	}
 
-	switch position {
-	case 0:
-		if len(hfc.entries) > 1 {
-			hfc.entries = hfc.entries[1:]
-			break
-		}
-		hfc.entries = make([]HostEntry, 0)
+	// Undoing restores the blank lines keepLeading handed over
+	removed, trailing := hfc.entries[position], hfc.trailing
+	var next *lineSource
+	if position+1 < len(hfc.entries) {
+		next = hfc.entries[position+1].source
+	}
 
-	case -1:
-		if len(hfc.entries) > 1 {
-			hfc.entries = hfc.entries[:len(hfc.entries)-1]
-			break
+	hfc.record(change{
+		op: Operation{Kind: OpDelete, Position: position, Entries: []HostEntry{removed}},
+		do: func() {
+			hfc.keepLeading(position, position)
+			hfc.removeAt(position)
+		},
+		undo: func() {
+			hfc.insertAt(removed, position)
+			if position+1 < len(hfc.entries) {
+				hfc.entries[position+1].source = next
+			}
+			hfc.trailing = trailing
+		},
+	})
+
+	return nil
+}
+
+// DeletePositions removes the entries at every position in a single pass,
+// positions refer to the entries before any of them is removed. It is
+// recorded as one delete in the history.
+func (hfc *hostsFileCtl) DeletePositions(positions ...int) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	remove := make(map[int]bool, len(positions))
+	for _, position := range positions {
+		if position < 0 || position >= len(hfc.entries) {
+			return fmt.Errorf("postion out of range: %d", position)
 		}
-		hfc.entries = make([]HostEntry, 0)
+		remove[position] = true
+	}
 
-	default:
-		hfc.entries = append(hfc.entries[:position], hfc.entries[position+1:] ...)
+	if len(remove) == 0 {
+		return nil
 	}
 
+	prevEntries, prevTrailing := hfc.entries, hfc.trailing
+	removed := make([]HostEntry, 0, len(remove))
+	for _, entry := range hfc.entries {
+		if remove[entry.Position] {
+			removed = append(removed, entry)
+		}
+	}
+
+	hfc.record(change{
+		op: Operation{Kind: OpDelete, Position: removed[0].Position, Entries: removed},
+		do: func() {
+			hfc.removeEach(remove)
+		},
+		undo: func() {
+			hfc.entries, hfc.trailing = prevEntries, prevTrailing
+			hfc.index = nil
+		},
+	})
+
 	return nil
+}
+
+// removeEach removes the entries at the positions and renumbers the rest once,
+// blank lines in front of a removed entry are handed over as keepLeading does
+func (hfc *hostsFileCtl) removeEach(remove map[int]bool) {
+
+	entries := make([]HostEntry, 0, len(hfc.entries))
+	var leading []byte
+	for _, entry := range hfc.entries {
+
+		if remove[entry.Position] {
+			leading = append(leading, entry.leading()...)
+			continue
+		}
+
+		if len(leading) > 0 {
+			entry.source = withLeading(entry.source, append(leading, entry.leading()...))
+			leading = nil
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(leading) > 0 {
+		hfc.trailing = append(leading, hfc.trailing...)
+	}
+
+	hfc.entries = entries
+	hfc.updatePosition()
+}
+
+// insertAt inserts the entry at position as is and renumbers the entries after it
+func (hfc *hostsFileCtl) insertAt(entry HostEntry, position int) {
+
+	// Appending keeps every other position valid
+	if position == len(hfc.entries) {
+		hfc.appendEntries(entry)
+		return
+	}
+
+	hfc.assignID(&entry)
+	defer hfc.renumber(position)
+
+	// Shifting in place saves copying every entry into a new slice
+	hfc.entries = append(hfc.entries, HostEntry{})
+	copy(hfc.entries[position+1:], hfc.entries[position:])
+	hfc.entries[position] = entry
 
+	if hfc.index != nil {
+		hfc.index.add(entry)
+	}
+}
+
+// removeAt removes the entry at position and nothing else, the entries after
+// it are renumbered
+func (hfc *hostsFileCtl) removeAt(position int) {
+
+	if hfc.index != nil {
+		hfc.index.remove(hfc.entries[position])
+	}
+
+	defer hfc.renumber(position)
+
+	if len(hfc.entries) == 1 {
+		hfc.entries = make([]HostEntry, 0)
+		return
+	}
+
+	hfc.entries = append(hfc.entries[:position], hfc.entries[position+1:] ...)
 }
 
 func (hfc *hostsFileCtl) Add(entry HostEntry, position int) error {
@@ -407,6 +927,10 @@ func (hfc *hostsFileCtl) Add(entry HostEntry, position int) error {
 		return err
 	}
 
+	if err := hfc.validateNames(&entry); err != nil {
+		return err
+	}
+
 	if position < -1 {
 		return fmt.Errorf("invalid position: %d", position)
 	}
@@ -414,34 +938,123 @@ func (hfc *hostsFileCtl) Add(entry HostEntry, position int) error {
 	hfc.rwLck.Lock()
 	defer hfc.rwLck.Unlock()
 
-	if position == len(hfc.entries) {
-		position = -1
+	return hfc.add(entry, position)
+}
+
+// add inserts a validated entry at position as a new entry, the write lock must be held
+func (hfc *hostsFileCtl) add(entry HostEntry, position int) error {
+
+	if position == -1 {
+		position = len(hfc.entries)
 	}
 
 	if position > len(hfc.entries) {
 		return fmt.Errorf("postion out of range: %d", position)
 	}
 
-	defer hfc.updatePosition()
+	// Added entries are new entries even when copied from an existing one
+	entry.id = 0
+	hfc.assignID(&entry)
+	entry.Position = position
 
-	switch position {
-	case 0:
-		hfc.entries = append([]HostEntry{entry}, hfc.entries ...)
-	case -1:
-		hfc.entries = append(hfc.entries, entry)
-	default:
-		hfc.entries = append(hfc.entries[:position], append([]HostEntry{entry}, hfc.entries[position:] ...) ...)
-	}
+	hfc.record(change{
+		op:   Operation{Kind: OpAdd, Position: position, Entries: []HostEntry{entry}},
+		do:   func() { hfc.insertAt(entry, position) },
+		undo: func() { hfc.removeAt(position) },
+	})
 
 	return nil
 }
 
+// Update replaces the entry at position, it keeps its id and the blank lines
+// and comments around it
+func (hfc *hostsFileCtl) Update(position int, entry HostEntry) error {
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	if err := hfc.validateNames(&entry); err != nil {
+		return err
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	return hfc.update(position, entry)
+}
+
+// Move moves the entry at from so it ends up at position to
+func (hfc *hostsFileCtl) Move(from, to int) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	return hfc.move(from, to)
+}
+
+// Upsert points the entry the resolver uses for the hostname at ip, keeping its
+// comment and, unless new ones are given, its aliases. A disabled entry is only
+// updated, and stays disabled, when the hostname has no enabled entry. The
+// entry is appended if the hostname does not exist yet. It returns the updated
+// or added entry.
+func (hfc *hostsFileCtl) Upsert(hostname, ip string, aliases ...string) (HostEntry, error) {
+
+	entry, err := NewHostEntry(ip, hostname, "", aliases...)
+	if err != nil {
+		return HostEntry{}, err
+	}
+
+	if entry.isComment {
+		return HostEntry{}, fmt.Errorf("ip address and hostname are required")
+	}
+
+	if err := hfc.validateNames(entry); err != nil {
+		return HostEntry{}, err
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	idx := hfc.lookupIndex()
+	ids := idx.byHostname[CanonicalName(hostname)]
+	if len(ids) == 0 {
+		if err := hfc.add(*entry, -1); err != nil {
+			return HostEntry{}, err
+		}
+		return hfc.entries[len(hfc.entries)-1], nil
+	}
+
+	matches := hfc.entriesOf(idx, ids)
+	existing, err := firstEnabled(matches, hostname)
+	if err != nil {
+		existing = matches[0]
+	}
+
+	entry.Hostname = existing.Hostname
+	entry.Comment = existing.Comment
+	entry.Disabled = existing.Disabled
+	if len(aliases) == 0 {
+		entry.Aliases = existing.Aliases
+	}
+
+	if err := entry.Validate(); err != nil {
+		return HostEntry{}, err
+	}
+
+	if err := hfc.update(existing.Position, *entry); err != nil {
+		return HostEntry{}, err
+	}
+
+	return hfc.entries[existing.Position], nil
+}
+
 func (hfc *hostsFileCtl) GetIP(ip string) ([]HostEntry, error) {
 	if len(hfc.entries) == 0 {
 		return nil, fmt.Errorf("no entries in file")
 	}
 
-	ipaddr := net.ParseIP(ip)
+	ipaddr, zone, mapped := parseAddress(ip)
 	if ipaddr == nil {
 		return nil, fmt.Errorf("invalid ip address specified: %s", ip)
 	}
@@ -449,12 +1062,12 @@ func (hfc *hostsFileCtl) GetIP(ip string) ([]HostEntry, error) {
 	hfc.rwLck.RLock()
 	defer hfc.rwLck.RUnlock()
 
+	// An address without a zone matches entries with any zone
 	entries := make([]HostEntry, 0)
-	for _, entry := range hfc.entries {
-		tmpEntry := entry
-		if strings.Compare(ip, entry.IPAddress.String()) == 0 {
-			entries = append(entries, tmpEntry)
-			break
+	idx := hfc.lookupIndex()
+	for _, entry := range hfc.entriesOf(idx, idx.byIP[string(ipaddr.To16())]) {
+		if ipEqual(ipaddr, mapped, entry.IPAddress, entry.mapped, hfc.mappedEqual) && (len(zone) == 0 || zone == entry.Zone) {
+			entries = append(entries, entry)
 		}
 	}
 
@@ -470,23 +1083,8 @@ func (hfc *hostsFileCtl) GetAlias(alias string) ([]HostEntry, error) {
 	hfc.rwLck.RLock()
 	defer hfc.rwLck.RUnlock()
 
-	entries := make([]HostEntry, 0)
-	for _, entry := range hfc.entries {
-
-		if entry.Aliases == nil || len(entry.Aliases) == 0 {
-			continue
-		}
-
-		tmpEntry := entry
-		for _, a := range entry.Aliases {
-			if strings.Compare(alias, a) == 0 {
-				entries = append(entries, tmpEntry)
-				break
-			}
-		}
-	}
-
-	return entries, nil
+	idx := hfc.lookupIndex()
+	return hfc.entriesOf(idx, idx.byAlias[CanonicalName(alias)]), nil
 }
 
 func (hfc *hostsFileCtl) GetHostname(hostname string) ([]HostEntry, error) {
@@ -498,16 +1096,58 @@ func (hfc *hostsFileCtl) GetHostname(hostname string) ([]HostEntry, error) {
 	hfc.rwLck.RLock()
 	defer hfc.rwLck.RUnlock()
 
-	entries := make([]HostEntry, 0)
-	for _, entry := range hfc.entries {
-		tmpEntry := entry
-		if strings.Compare(hostname, entry.Hostname) == 0 {
-			entries = append(entries, tmpEntry)
-			break
+	idx := hfc.lookupIndex()
+	return hfc.entriesOf(idx, idx.byHostname[CanonicalName(hostname)]), nil
+}
+
+// firstEnabled returns the first entry that is neither a comment nor disabled
+func firstEnabled(entries []HostEntry, query string) (HostEntry, error) {
+	for _, entry := range entries {
+		if !entry.isComment && !entry.Disabled {
+			return entry, nil
 		}
 	}
+	return HostEntry{}, fmt.Errorf("%w: %s", ErrNotFound, query)
+}
 
-	return entries, nil
+// GetFirstIP returns the first enabled entry for the ip address, the resolver
+// only uses the first matching line
+func (hfc *hostsFileCtl) GetFirstIP(ip string) (HostEntry, error) {
+	entries, err := hfc.GetIP(ip)
+	if err != nil {
+		return HostEntry{}, err
+	}
+	return firstEnabled(entries, ip)
+}
+
+// GetFirstHostname returns the first enabled entry with the hostname
+func (hfc *hostsFileCtl) GetFirstHostname(hostname string) (HostEntry, error) {
+	entries, err := hfc.GetHostname(hostname)
+	if err != nil {
+		return HostEntry{}, err
+	}
+	return firstEnabled(entries, hostname)
+}
+
+// GetFirstAlias returns the first enabled entry with the alias
+func (hfc *hostsFileCtl) GetFirstAlias(alias string) (HostEntry, error) {
+	entries, err := hfc.GetAlias(alias)
+	if err != nil {
+		return HostEntry{}, err
+	}
+	return firstEnabled(entries, alias)
+}
+
+// Resolve returns the entry the resolver uses for the name: the first enabled
+// entry in file order that has it as hostname or alias
+func (hfc *hostsFileCtl) Resolve(name string) (HostEntry, error) {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	idx, key := hfc.lookupIndex(), CanonicalName(name)
+	entries := hfc.entriesOf(idx, idx.byHostname[key], idx.byAlias[key])
+	return firstEnabled(entries, name)
 }
 
 // Read will update the hostfile control entries from a io.Reader
@@ -518,6 +1158,18 @@ func (hfc *hostsFileCtl) Read(reader io.Reader) error {
 // Write will write all the entries to the write specified
 func (hfc *hostsFileCtl) Write(writer io.Writer) (int, error) {
 
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	return hfc.write(writer)
+}
+
+func (hfc *hostsFileCtl) write(writer io.Writer) (int, error) {
+
+	if hfc.lossless {
+		return hfc.writeLossless(writer)
+	}
+
 	if hfc.entries == nil || len(hfc.entries) <= 0 {
 		return 0, nil
 	}
@@ -539,7 +1191,8 @@ func (hfc *hostsFileCtl) Write(writer io.Writer) (int, error) {
 			count += c
 		}
 
-		c, err = entry.Write(writer)
+		output := hfc.output(entry)
+		c, err = output.Write(writer)
 		if err != nil {
 			return 0, err
 		}
@@ -558,35 +1211,108 @@ func (hfc *hostsFileCtl) Write(writer io.Writer) (int, error) {
 	return count, nil
 }
 
+// writeLossless writes untouched entries exactly as they were read and only
+// renders the entries that were added or modified
+func (hfc *hostsFileCtl) writeLossless(writer io.Writer) (int, error) {
+
+	defaultEOL := hfc.eol
+	if defaultEOL == nil {
+		defaultEOL = []byte(CarriageReturnLineFeed)
+	}
+
+	count := 0
+	for n, entry := range hfc.entries {
+
+		output := hfc.output(entry)
+		rendered, err := output.render()
+		if err != nil {
+			return 0, err
+		}
+
+		line, eol := rendered, defaultEOL
+		if entry.source != nil {
+			c, err := writer.Write(entry.source.leading)
+			if err != nil {
+				return 0, err
+			}
+			count += c
+
+			if entry.unchanged(rendered) {
+				line = entry.source.raw
+			}
+
+			// Keep a missing line ending on the final line
+			if len(entry.source.eol) > 0 {
+				eol = entry.source.eol
+			} else if entry.source.raw != nil && n == len(hfc.entries)-1 && len(hfc.trailing) == 0 {
+				eol = nil
+			}
+		}
+
+		c, err := writer.Write(line)
+		if err != nil {
+			return 0, err
+		}
+		count += c
+
+		c, err = writer.Write(eol)
+		if err != nil {
+			return 0, err
+		}
+		count += c
+	}
+
+	c, err := writer.Write(hfc.trailing)
+	if err != nil {
+		return 0, err
+	}
+
+	return count + c, nil
+}
+
 // Sync entries to the actual file
-// Reverts on any failure back to the original file contents
+// The file is replaced atomically, see replaceFile, while holding an exclusive
+// lock. A *ConflictError is returned if the file was modified since it was loaded.
 func (hfc *hostsFileCtl) Sync() (int, error) {
 
-	s, err := os.Stat(hfc.hostsFile)
+	unlock, err := hfc.lock(true)
 	if err != nil {
 		return 0, err
 	}
+	defer unlock()
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	return hfc.sync()
+}
 
-	// Read in the existing contents to revert in cause of failure
-	contents, err := ioutil.ReadFile(hfc.hostsFile)
+// sync writes the entries to the file, the file lock and write lock must be held
+func (hfc *hostsFileCtl) sync() (int, error) {
+
+	current, err := hfc.checkConflict()
 	if err != nil {
-		return 0, fmt.Errorf("failed to read existing file to make backup: %s", err)
+		return 0, err
 	}
 
-	defer func(err error) {
-		if err != nil {
-			ioutil.WriteFile(hfc.hostsFile, contents, s.Mode())
-		}
-	}(err)
+	if err := hfc.backup(current); err != nil {
+		return 0, err
+	}
 
-	var f *os.File
-	f, err = os.OpenFile(hfc.hostsFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.Mode())
+	buf := bytes.NewBuffer(nil)
+	if _, err := hfc.write(buf); err != nil {
+		return 0, err
+	}
+
+	count, err := replaceFile(hfc.hostsFile, func(writer io.Writer) (int, error) {
+		return writer.Write(buf.Bytes())
+	})
 	if err != nil {
 		return 0, err
 	}
-	defer f.Close()
 
-	return hfc.Write(f)
+	hfc.synced(buf.Bytes())
+	return count, nil
 }
 
 func (hfc *hostsFileCtl) Entries() []HostEntry {
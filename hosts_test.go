@@ -2,10 +2,13 @@ package go_hostctl
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -105,6 +108,87 @@ func TestHostsFileCtl_Delete(t *testing.T) {
 
 }
 
+func TestHostsFileCtl_DeletePositions(t *testing.T) {
+
+	original, err := ioutil.ReadFile("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oneByOne, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries preceded by blank lines, the last one and neighbours of each other
+	last := len(batch.Entries()) - 1
+	positions := []int{last, 4, 5, 0, 9, 4}
+	kept := batch.Entries()[1]
+
+	if err := batch.DeletePositions(positions...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, position := range []int{last, 9, 5, 4, 0} {
+		if err := oneByOne.Delete(position); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, got := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	if _, err := oneByOne.Write(expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := batch.Write(got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(expected.Bytes(), got.Bytes()) {
+		t.Fatalf("expecting the same output as deleting one by one, got:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	entries := batch.Entries()
+	if len(entries) != last-4 || entries[0].Position != 0 || entries[0].ID() != kept.ID() {
+		t.Fatalf("expecting 5 entries removed and the rest renumbered, got: %v", entries)
+	}
+
+	if found, err := batch.GetID(kept.ID()); err != nil || found.Position != 0 {
+		t.Fatalf("expecting the index to follow the new positions, got: %v, %v", found, err)
+	}
+
+	if history := batch.History(); len(history) != 1 || len(history[0].Entries) != 5 || history[0].Position != 0 {
+		t.Fatalf("expecting a single delete in the history, got: %v", history)
+	}
+
+	// Undoing puts every entry and blank line back
+	if err := batch.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	got.Reset()
+	if _, err := batch.Write(got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(original, got.Bytes()) {
+		t.Fatalf("expecting the original file back, got:\n%s", got)
+	}
+
+	if err := batch.DeletePositions(0, last+1); err == nil {
+		t.Fatalf("expecting an out of range position to be rejected")
+	}
+
+	if len(batch.Entries()) != last+1 {
+		t.Fatalf("expecting nothing to be deleted when a position is out of range")
+	}
+}
+
 func TestHostsFileCtl_Add(t *testing.T) {
 
 	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_Add")
@@ -359,4 +443,355 @@ func TestHostsFileCtl_Read(t *testing.T) {
 	if len(hctlTest.Entries()) <= 0 {
 		t.Fatalf("missing entries")
 	}
-}
\ No newline at end of file
+}
+
+func TestHostsFileCtl_Lossless(t *testing.T) {
+
+	original, err := ioutil.ReadFile("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(original, buf.Bytes()) {
+		t.Fatalf("expecting unmodified output to match the original file, got:\n%s", buf.Bytes())
+	}
+
+	// Remove the "# Host Entry 2" comment and append a new entry
+	if err := hctl.Delete(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*hostEntry1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bytes.Replace(original, []byte("\t\t# Host Entry 2\n"), nil, 1)
+	expected = append(expected, []byte(hostEntry1.String()+"\n")...)
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Fatalf("expecting only the edited lines to change, got:\n%s", buf.Bytes())
+	}
+}
+
+func TestHostsFileCtl_SyncAtomic(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestHostsFileCtl_SyncAtomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostsFile, []byte("127.0.0.1 localhost\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*hostEntry1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := os.Stat(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Mode() != 0640 {
+		t.Fatalf("expecting file mode to be preserved, got: %s", s.Mode())
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expecting no temporary files to be left behind, got %d files", len(files))
+	}
+
+	check, err := NewHostFileCtl(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(hctl.Entries(), check.Entries()) {
+		t.Fatalf("mismatch entries")
+	}
+}
+
+func TestHostsFileCtl_SyncSymlink(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestHostsFileCtl_SyncSymlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "real_hosts")
+	if err := ioutil.WriteFile(target, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := os.Symlink(target, hostsFile); err != nil {
+		t.Skipf("symlinks are not supported: %s", err)
+	}
+
+	hctl, err := NewHostFileCtl(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*hostEntry1, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The link is kept and the change lands in its target
+	s, err := os.Lstat(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expecting the hosts file to still be a symlink, got: %s", s.Mode())
+	}
+
+	contents, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(contents), hostEntry1.String()) {
+		t.Fatalf("expecting the entry to be written to the target, got:\n%s", contents)
+	}
+}
+
+func TestHostsFileCtl_GetMultiple(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := hctl.GetIP("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 5 {
+		t.Fatalf("expecting 5 entries, got: %d", len(entries))
+	}
+
+	entries, err = hctl.GetHostname("host_entry_4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expecting 3 entries, got: %d", len(entries))
+	}
+
+	first, err := hctl.GetFirstHostname("host_entry_4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.IPAddress.String() != "12.12.12.12" {
+		t.Fatalf("expecting first entry to win, got: %s", first.IPAddress)
+	}
+
+	// h0 is an alias of host_entry_1 first
+	resolved, err := hctl.Resolve("h0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.Hostname != "host_entry_1" {
+		t.Fatalf("expecting h0 to resolve via host_entry_1, got: %s", resolved.Hostname)
+	}
+
+	if _, err := hctl.GetFirstAlias("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expecting not found error, got: %v", err)
+	}
+}
+
+func TestHostsFileCtl_Update(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	existing, err := hctl.GetFirstHostname("host_entry_3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := NewHostEntry("11.11.11.12", "host_entry_3", "# updated", "h3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Update(existing.Position, *entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Update(len(hctl.Entries()), *entry); err == nil {
+		t.Fatalf("expecting an out of range error")
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The comment block in front of the entry and the blank lines around it are kept
+	if !strings.Contains(buf.String(), "\n\n# Host entry 3\n# With another comment\n11.11.11.12\thost_entry_3\th3\t# updated\n\n\n# Host entry 4\n") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	updated := hctl.Entries()[existing.Position]
+	if updated.ID() != existing.ID() || updated.IPAddress.String() != "11.11.11.12" {
+		t.Fatalf("expecting the entry to be updated in place, got: %v", updated)
+	}
+}
+
+func TestHostsFileCtl_Move(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := len(hctl.Entries()) - 1
+	entry := hctl.Entries()[last]
+
+	if err := hctl.Move(last, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if moved := hctl.Entries()[0]; moved.ID() != entry.ID() || moved.Position != 0 {
+		t.Fatalf("expecting %v at position 0, got: %v", entry, moved)
+	}
+
+	if err := hctl.Move(0, last); err != nil {
+		t.Fatal(err)
+	}
+
+	if moved := hctl.Entries()[last]; moved.ID() != entry.ID() || moved.Position != last {
+		t.Fatalf("expecting %v at position %d, got: %v", entry, last, moved)
+	}
+
+	if err := hctl.Move(0, last+1); err == nil {
+		t.Fatalf("expecting an out of range error")
+	}
+}
+
+func TestHostsFileCtl_Upsert(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := len(hctl.Entries())
+	existing, err := hctl.GetFirstHostname("some_macos.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := hctl.Upsert("Some_MacOS.local", "10.0.0.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Position != existing.Position || entry.ID() != existing.ID() || entry.String() != "10.0.0.9\tsome_macos.local\tsome_macos\t#: special" {
+		t.Fatalf("expecting the existing entry to be updated, got: %v", entry)
+	}
+
+	entry, err = hctl.Upsert("new.host", "10.0.0.10", "nh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Position != count || entry.String() != "10.0.0.10\tnew.host\tnh" || len(hctl.Entries()) != count+1 {
+		t.Fatalf("expecting the entry to be appended, got: %v", entry)
+	}
+
+	if _, err := hctl.Upsert("new.host", "not an ip"); err == nil {
+		t.Fatalf("expecting an invalid ip address error")
+	}
+}
+
+func TestHostsFileCtl_UpsertDisabled(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_UpsertDisabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hctl, err := NewHostFileCtl(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("# 10.0.0.5\tb.internal\n10.0.0.9 b.internal\n# 10.0.0.7\tc.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The enabled entry the resolver uses is updated, not the commented out one before it
+	entry, err := hctl.Upsert("b.internal", "10.0.0.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Position != 1 || entry.Disabled || entry.IPAddress.String() != "10.0.0.6" {
+		t.Fatalf("expecting the enabled entry to be updated, got: %v", entry)
+	}
+
+	if resolved, err := hctl.Resolve("b.internal"); err != nil || resolved.IPAddress.String() != "10.0.0.6" {
+		t.Fatalf("expecting b.internal to resolve to 10.0.0.6, got: %v, %v", resolved, err)
+	}
+
+	if disabled := hctl.Entries()[0]; !disabled.Disabled || disabled.IPAddress.String() != "10.0.0.5" {
+		t.Fatalf("expecting the disabled entry to be left alone, got: %v", disabled)
+	}
+
+	// Without an enabled entry the disabled one is updated and stays disabled
+	entry, err = hctl.Upsert("c.internal", "10.0.0.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Position != 2 || !entry.Disabled || entry.IPAddress.String() != "10.0.0.8" || len(hctl.Entries()) != 3 {
+		t.Fatalf("expecting the disabled entry to be updated, got: %v", entry)
+	}
+}
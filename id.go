@@ -0,0 +1,162 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EntryID identifies an entry for the lifetime of a HostFileCtl, unlike its
+// position it does not change when other entries are added, deleted or moved.
+// Entries get new ids when the file is reloaded by Rebase or Restore.
+type EntryID uint64
+
+var ErrUnknownID = errors.New("no entry with id")
+
+// ID returns the id of the entry, zero for an entry that is not part of a HostFileCtl
+func (he HostEntry) ID() EntryID {
+	return he.id
+}
+
+// assignID hands out the next id to an entry that does not have one, the write lock must be held
+func (hfc *hostsFileCtl) assignID(entry *HostEntry) {
+	if entry.id == 0 {
+		hfc.lastID++
+		entry.id = hfc.lastID
+	}
+}
+
+// position returns the current position of the entry with the id, the read or write lock must be held
+func (hfc *hostsFileCtl) position(id EntryID) (int, error) {
+	position, ok := hfc.lookupIndex().byID[id]
+	if !ok || id == 0 {
+		return -1, fmt.Errorf("%w: %d", ErrUnknownID, id)
+	}
+	return position, nil
+}
+
+// update replaces the entry at position keeping its id and the lines around
+// it, the write lock must be held
+func (hfc *hostsFileCtl) update(position int, entry HostEntry) error {
+
+	if position < 0 || position >= len(hfc.entries) {
+		return fmt.Errorf("postion out of range: %d", position)
+	}
+
+	current := hfc.entries[position]
+	entry.id = current.id
+	entry.source = current.source
+	entry.Position = position
+
+	hfc.record(change{
+		op: Operation{Kind: OpUpdate, Position: position, Entries: []HostEntry{current, entry}},
+		do: func() {
+			hfc.replaceAt(entry, position)
+		},
+		undo: func() {
+			hfc.replaceAt(current, position)
+		},
+	})
+
+	return nil
+}
+
+// move moves the entry at from so it ends up at position to, the blank lines
+// in front of it stay where they are. The write lock must be held.
+func (hfc *hostsFileCtl) move(from, to int) error {
+
+	if from < 0 || from >= len(hfc.entries) {
+		return fmt.Errorf("postion out of range: %d", from)
+	}
+
+	if to < 0 || to >= len(hfc.entries) {
+		return fmt.Errorf("postion out of range: %d", to)
+	}
+
+	if from == to {
+		return nil
+	}
+
+	hfc.forget()
+
+	entry := hfc.entries[from]
+	hfc.keepLeading(from, from)
+	if entry.source != nil {
+		entry.source = withLeading(entry.source, nil)
+	}
+
+	// Only the entries between from and to change position, the index keeps
+	// its keys as the moved entry keeps its id
+	first := from
+	if to < first {
+		first = to
+	}
+	defer hfc.renumber(first)
+
+	entries := append(hfc.entries[:from:from], hfc.entries[from+1:]...)
+	hfc.entries = append(entries[:to:to], append([]HostEntry{entry}, entries[to:]...)...)
+	return nil
+}
+
+// GetID returns the entry with the id
+func (hfc *hostsFileCtl) GetID(id EntryID) (HostEntry, error) {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	position, err := hfc.position(id)
+	if err != nil {
+		return HostEntry{}, err
+	}
+
+	return hfc.entries[position], nil
+}
+
+// DeleteID deletes the entry with the id
+func (hfc *hostsFileCtl) DeleteID(id EntryID) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	position, err := hfc.position(id)
+	if err != nil {
+		return err
+	}
+
+	return hfc.delete(position)
+}
+
+// UpdateID replaces the entry with the id, the entry keeps its id and position
+func (hfc *hostsFileCtl) UpdateID(id EntryID, entry HostEntry) error {
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	if err := hfc.validateNames(&entry); err != nil {
+		return err
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	position, err := hfc.position(id)
+	if err != nil {
+		return err
+	}
+
+	return hfc.update(position, entry)
+}
+
+// MoveID moves the entry with the id so it ends up at position
+func (hfc *hostsFileCtl) MoveID(id EntryID, position int) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	from, err := hfc.position(id)
+	if err != nil {
+		return err
+	}
+
+	return hfc.move(from, position)
+}
@@ -0,0 +1,158 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHostsFileCtl_IDs(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[EntryID]bool)
+	for _, entry := range hctl.Entries() {
+		if entry.ID() == 0 || seen[entry.ID()] {
+			t.Fatalf("expecting a unique id, got: %d", entry.ID())
+		}
+		seen[entry.ID()] = true
+	}
+
+	target, err := hctl.GetFirstHostname("some_server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits in front of the entry change its position but not its id
+	if err := hctl.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(target, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if hctl.Entries()[0].ID() == target.ID() {
+		t.Fatalf("expecting an added copy to get a new id")
+	}
+
+	entry, err := hctl.GetID(target.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Hostname != "some_server" || entry.Position != target.Position {
+		t.Fatalf("expecting some_server at %d, got: %v at %d", target.Position, entry, entry.Position)
+	}
+
+	updated, err := NewHostEntry("10.9.9.9", "some_server", "# moved", "ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.UpdateID(target.ID(), *updated); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err = hctl.GetFirstIP("10.9.9.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.ID() != target.ID() || entry.Position != target.Position {
+		t.Fatalf("expecting the update in place, got: %v at %d", entry, entry.Position)
+	}
+
+	if err := hctl.MoveID(target.ID(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := hctl.Entries(); entries[1].ID() != target.ID() || entries[1].Hostname != "some_server" {
+		t.Fatalf("expecting some_server at position 1, got: %v", entries[1])
+	}
+
+	if err := hctl.DeleteID(target.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.GetID(target.ID()); !errors.Is(err, ErrUnknownID) {
+		t.Fatalf("expecting ErrUnknownID, got: %v", err)
+	}
+
+	if err := hctl.DeleteID(target.ID()); !errors.Is(err, ErrUnknownID) {
+		t.Fatalf("expecting ErrUnknownID, got: %v", err)
+	}
+
+	if err := hctl.MoveID(hctl.Entries()[0].ID(), len(hctl.Entries())); err == nil {
+		t.Fatalf("expecting an out of range error")
+	}
+}
+
+func TestHostsFileCtl_DeleteIDConcurrent(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]EntryID, 0)
+	for _, entry := range hctl.Entries() {
+		if strings.HasPrefix(entry.Hostname, "host_entry") {
+			ids = append(ids, entry.ID())
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id EntryID) {
+			defer wg.Done()
+			if err := hctl.DeleteID(id); err != nil {
+				t.Error(err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	for _, entry := range hctl.Entries() {
+		if strings.HasPrefix(entry.Hostname, "host_entry") {
+			t.Fatalf("expecting every host_entry to be deleted, got: %v", entry)
+		}
+	}
+}
+
+func TestHostsFileCtl_MoveIDLossless(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("\n10.1.1.1   moved.host\n10.1.1.2   last.host\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := hctl.GetFirstHostname("moved.host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.MoveID(moved.ID(), len(hctl.Entries())-1); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The blank line stays in place and the moved line is kept verbatim
+	if !strings.HasSuffix(buf.String(), "some_macos #: special\n\n10.1.1.2   last.host\n10.1.1.1   moved.host\n") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
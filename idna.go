@@ -0,0 +1,68 @@
+package go_hostctl
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps names as resolvers do (UTS #46) but, like PermissiveNames,
+// leaves the allowed ASCII characters to the name validator
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.Transitional(false), idna.StrictDomainName(false))
+
+func isASCII(name string) bool {
+	for n := 0; n < len(name); n++ {
+		if name[n] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ToASCIIName returns the punycode (xn--) form of a name with non-ASCII
+// labels, ASCII names are returned as is
+func ToASCIIName(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	return idnaProfile.ToASCII(name)
+}
+
+// ToUnicodeName returns the Unicode form of a name with punycode (xn--)
+// labels, other names and names that are not valid punycode are returned as is
+func ToUnicodeName(name string) string {
+	if !strings.Contains(strings.ToLower(name), "xn--") {
+		return name
+	}
+
+	unicode, err := idnaProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return unicode
+}
+
+// Unicode returns a copy of the entry with its hostname and aliases in
+// Unicode form for display. Validating the copy turns them back into their
+// punycode form.
+func (he HostEntry) Unicode() HostEntry {
+
+	if he.isComment || he.IPAddress == nil {
+		return he
+	}
+
+	he.Hostname = ToUnicodeName(he.Hostname)
+	aliases := make([]string, len(he.Aliases))
+	for n, alias := range he.Aliases {
+		aliases[n] = ToUnicodeName(alias)
+	}
+	he.Aliases = aliases
+
+	// Keep the comment of parsed entries that were never formatted
+	if he.rawLine != nil {
+		he.format()
+	}
+
+	return he
+}
@@ -0,0 +1,93 @@
+package go_hostctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIDNANames(t *testing.T) {
+
+	tests := map[string]string{
+		"bücher.example": "xn--bcher-kva.example",
+		"BÜCHER.example": "xn--bcher-kva.example",
+		"münchen.de":     "xn--mnchen-3ya.de",
+		"some_server":    "some_server",
+		"api.internal":   "api.internal",
+	}
+
+	for name, expected := range tests {
+		ascii, err := ToASCIIName(name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if ascii != expected {
+			t.Fatalf("%s: expecting %s, got: %s", name, expected, ascii)
+		}
+
+		if unicode := ToUnicodeName(ascii); unicode != strings.ToLower(name) {
+			t.Fatalf("%s: expecting %s back, got: %s", ascii, strings.ToLower(name), unicode)
+		}
+	}
+
+	if _, err := ToASCIIName("bü-.example"); err == nil {
+		t.Fatalf("expecting a label ending with a hyphen to be rejected")
+	}
+
+	if _, err := NewHostEntry("10.0.0.1", "\u0301ab.example", ""); err == nil {
+		t.Fatalf("expecting a label starting with a combining mark to be rejected")
+	}
+}
+
+func TestHostsFileCtl_IDNA(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := NewHostEntry("10.0.0.1", "bücher.example", "", "münchen.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Hostname != "xn--bcher-kva.example" || entry.Aliases[0] != "xn--mnchen-3ya.de" {
+		t.Fatalf("expecting the punycode form to be stored, got: %v", entry)
+	}
+
+	if err := hctl.Add(*entry, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.0.0.2 ñandú.example\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"bücher.example", "xn--bcher-kva.example", "BÜCHER.example."} {
+		entries, err := hctl.GetHostname(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 1 || entries[0].IPAddress.String() != "10.0.0.1" {
+			t.Fatalf("%s: expecting the 10.0.0.1 entry, got: %v", name, entries)
+		}
+	}
+
+	resolved, err := hctl.Resolve("ñandú.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.Hostname != "xn--and-6ma2c.example" {
+		t.Fatalf("expecting the read name in punycode form, got: %v", resolved)
+	}
+
+	if unicode := resolved.Unicode(); unicode.Hostname != "ñandú.example" || unicode.String() != "10.0.0.2\tñandú.example" {
+		t.Fatalf("expecting the Unicode form for display, got: %v", unicode)
+	}
+
+	if resolved.String() != "10.0.0.2\txn--and-6ma2c.example" {
+		t.Fatalf("expecting the punycode form to be written, got: %v", resolved)
+	}
+}
@@ -0,0 +1,168 @@
+package go_hostctl
+
+import "sort"
+
+// entryIndex maps addresses and canonical names to entry ids and ids to
+// positions so lookups do not scan every entry of large hosts files. Name and
+// address keys are kept by id so inserting or removing an entry only has to
+// renumber byID instead of rebuilding the whole index.
+type entryIndex struct {
+	byID       map[EntryID]int
+	byIP       map[string][]EntryID
+	byHostname map[string][]EntryID
+	byAlias    map[string][]EntryID
+}
+
+func newEntryIndex(entries []HostEntry) *entryIndex {
+
+	idx := &entryIndex{
+		byID:       make(map[EntryID]int),
+		byIP:       make(map[string][]EntryID),
+		byHostname: make(map[string][]EntryID),
+		byAlias:    make(map[string][]EntryID),
+	}
+
+	for _, entry := range entries {
+		idx.add(entry)
+	}
+
+	return idx
+}
+
+// ipKey is the 16 byte form of the address, IPv4 and IPv4-mapped addresses
+// share a key and are told apart by ipEqual
+func ipKey(entry HostEntry) string {
+	return string(entry.IPAddress.To16())
+}
+
+// add indexes an entry at its position
+func (idx *entryIndex) add(entry HostEntry) {
+
+	idx.byID[entry.id] = entry.Position
+
+	if entry.isComment || entry.IPAddress == nil {
+		return
+	}
+
+	key := ipKey(entry)
+	idx.byIP[key] = append(idx.byIP[key], entry.id)
+
+	hostname := CanonicalName(entry.Hostname)
+	idx.byHostname[hostname] = append(idx.byHostname[hostname], entry.id)
+
+	for _, alias := range entry.Aliases {
+		alias = CanonicalName(alias)
+		if ids := idx.byAlias[alias]; len(ids) == 0 || ids[len(ids)-1] != entry.id {
+			idx.byAlias[alias] = append(ids, entry.id)
+		}
+	}
+}
+
+// remove drops an entry indexed by add, the positions of the entries after it
+// are left for renumber to fix
+func (idx *entryIndex) remove(entry HostEntry) {
+
+	delete(idx.byID, entry.id)
+
+	if entry.isComment || entry.IPAddress == nil {
+		return
+	}
+
+	removeID(idx.byIP, ipKey(entry), entry.id)
+	removeID(idx.byHostname, CanonicalName(entry.Hostname), entry.id)
+	for _, alias := range entry.Aliases {
+		removeID(idx.byAlias, CanonicalName(alias), entry.id)
+	}
+}
+
+// removeID removes id from the ids kept under key
+func removeID(ids map[string][]EntryID, key string, id EntryID) {
+
+	kept := ids[key][:0]
+	for _, other := range ids[key] {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(ids, key)
+		return
+	}
+	ids[key] = kept
+}
+
+// lookupIndex returns the index of the entries, building it if entries were
+// replaced since it was last built. The read or write lock must be held.
+func (hfc *hostsFileCtl) lookupIndex() *entryIndex {
+
+	hfc.indexLck.Lock()
+	defer hfc.indexLck.Unlock()
+
+	if hfc.index == nil {
+		hfc.index = newEntryIndex(hfc.entries)
+	}
+
+	return hfc.index
+}
+
+// appendEntries adds entries at the end and updates the index in place
+// instead of rebuilding it. The write lock must be held.
+func (hfc *hostsFileCtl) appendEntries(entries ...HostEntry) {
+	for _, entry := range entries {
+		entry.Position = len(hfc.entries)
+		hfc.assignID(&entry)
+		hfc.entries = append(hfc.entries, entry)
+		if hfc.index != nil {
+			hfc.index.add(entry)
+		}
+	}
+}
+
+// replaceAt replaces the entry at position and reindexes it, the write lock must be held
+func (hfc *hostsFileCtl) replaceAt(entry HostEntry, position int) {
+
+	if hfc.index != nil {
+		hfc.index.remove(hfc.entries[position])
+	}
+
+	hfc.entries[position] = entry
+
+	if hfc.index != nil {
+		hfc.index.add(entry)
+	}
+}
+
+// renumber updates the positions from position on, in the entries and in the
+// index, after an entry was inserted or removed there
+func (hfc *hostsFileCtl) renumber(position int) {
+	for n := position; n < len(hfc.entries); n++ {
+		hfc.entries[n].Position = n
+		if hfc.index != nil {
+			hfc.index.byID[hfc.entries[n].id] = n
+		}
+	}
+}
+
+// entriesOf returns the entries with the ids in file order without duplicates
+func (hfc *hostsFileCtl) entriesOf(idx *entryIndex, ids ...[]EntryID) []HostEntry {
+
+	positions := make([]int, 0)
+	for _, list := range ids {
+		for _, id := range list {
+			positions = append(positions, idx.byID[id])
+		}
+	}
+
+	sort.Ints(positions)
+
+	entries := make([]HostEntry, 0, len(positions))
+	for n, position := range positions {
+		if n > 0 && positions[n-1] == position {
+			continue
+		}
+		entries = append(entries, hfc.entries[position])
+	}
+
+	return entries
+}
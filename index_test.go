@@ -0,0 +1,245 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scan is the linear lookup the index replaces
+func scan(entries []HostEntry, match func(entry HostEntry) bool) []HostEntry {
+	found := make([]HostEntry, 0)
+	for _, entry := range entries {
+		if !entry.isComment && entry.IPAddress != nil && match(entry) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+func TestHostsFileCtl_IndexConsistency(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+
+	// pick returns a random entry that is not a comment, leaving the block
+	// markers alone
+	pick := func() (HostEntry, bool) {
+		entries := make([]HostEntry, 0)
+		for _, entry := range hctl.Entries() {
+			if !entry.isComment {
+				entries = append(entries, entry)
+			}
+		}
+		if len(entries) == 0 {
+			return HostEntry{}, false
+		}
+		return entries[rnd.Intn(len(entries))], true
+	}
+
+	for n := 0; n < 500; n++ {
+
+		ip := fmt.Sprintf("10.0.0.%d", rnd.Intn(8))
+		name := fmt.Sprintf("Host%d", rnd.Intn(8))
+		alias := fmt.Sprintf("alias%d.", rnd.Intn(8))
+
+		switch rnd.Intn(7) {
+		case 0:
+			entry, err := NewHostEntry(ip, name, "", alias)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := hctl.Add(*entry, rnd.Intn(len(hctl.Entries())+1)); err != nil {
+				t.Fatal(err)
+			}
+		case 1:
+			if err := hctl.Read(strings.NewReader(fmt.Sprintf("%s %s %s\n", ip, name, alias))); err != nil {
+				t.Fatal(err)
+			}
+		case 2:
+			if entry, ok := pick(); ok {
+				if err := hctl.Delete(entry.Position); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case 3:
+			entry, err := NewHostEntry(ip, name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := hctl.ReplaceBlock("index", []HostEntry{*entry}); err != nil {
+				t.Fatal(err)
+			}
+		case 4:
+			entry, err := NewHostEntry(ip, name, "", alias)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if existing, ok := pick(); ok {
+				if err := hctl.Update(existing.Position, *entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case 5:
+			if entry, ok := pick(); ok {
+				if err := hctl.MoveID(entry.ID(), rnd.Intn(len(hctl.Entries()))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		case 6:
+			if err := hctl.Undo(); err != nil && !errors.Is(err, ErrNothingToUndo) {
+				t.Fatal(err)
+			}
+		}
+
+		if len(hctl.Entries()) == 0 {
+			continue
+		}
+
+		all := hctl.Entries()
+		for _, entry := range all {
+			if found, err := hctl.GetID(entry.ID()); err != nil || found.Position != entry.Position {
+				t.Fatalf("step %d: GetID(%d) expecting position %d, got: %v, %v", n, entry.ID(), entry.Position, found, err)
+			}
+		}
+
+		query := fmt.Sprintf("host%d", rnd.Intn(8))
+
+		byIP, err := hctl.GetIP(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := scan(all, func(e HostEntry) bool { return e.IPAddress.String() == ip }); !reflect.DeepEqual(byIP, expected) {
+			t.Fatalf("step %d: GetIP(%s) expecting %v, got: %v", n, ip, expected, byIP)
+		}
+
+		byName, err := hctl.GetHostname(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := scan(all, func(e HostEntry) bool { return NamesEqual(e.Hostname, query) }); !reflect.DeepEqual(byName, expected) {
+			t.Fatalf("step %d: GetHostname(%s) expecting %v, got: %v", n, query, expected, byName)
+		}
+
+		byAlias, err := hctl.GetAlias(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := scan(all, func(e HostEntry) bool {
+			for _, a := range e.Aliases {
+				if NamesEqual(a, alias) {
+					return true
+				}
+			}
+			return false
+		})
+		if !reflect.DeepEqual(byAlias, expected) {
+			t.Fatalf("step %d: GetAlias(%s) expecting %v, got: %v", n, alias, expected, byAlias)
+		}
+	}
+}
+
+func TestHostsFileCtl_IndexLargeFile(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interleaved appends and lookups stay linear with an incrementally updated index
+	for n := 0; n < 100000; n++ {
+		entry, err := NewHostEntry("0.0.0.0", fmt.Sprintf("ads%d.example.com", n), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := hctl.Add(*entry, -1); err != nil {
+			t.Fatal(err)
+		}
+
+		if n%100 == 0 {
+			if _, err := hctl.GetFirstHostname(entry.Hostname); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	entries, err := hctl.GetIP("0.0.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 100000 || entries[99999].Hostname != "ads99999.example.com" {
+		t.Fatalf("expecting 100000 entries, got: %d", len(entries))
+	}
+}
+
+// largeHosts returns a control for a block list of size entries
+func largeHosts(b *testing.B, size int) HostFileCtl {
+
+	var buf strings.Builder
+	for n := 0; n < size; n++ {
+		fmt.Fprintf(&buf, "0.0.0.0 ads%d.example.com\n", n)
+	}
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader(buf.String())); err != nil {
+		b.Fatal(err)
+	}
+
+	return hctl
+}
+
+func BenchmarkHostsFileCtl_LookupDelete(b *testing.B) {
+
+	hctl := largeHosts(b, 100000)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		entry, err := hctl.GetFirstHostname(fmt.Sprintf("ads%d.example.com", n%100000))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := hctl.DeleteID(entry.ID()); err != nil {
+			b.Fatal(err)
+		}
+
+		// Putting it back keeps the file the same size for the next lookup
+		if err := hctl.Undo(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHostsFileCtl_InsertLookup(b *testing.B) {
+
+	hctl := largeHosts(b, 100000)
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		entry, err := NewHostEntry("10.0.0.1", fmt.Sprintf("new%d.example.com", n), "")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := hctl.Add(*entry, 0); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := hctl.GetHostname(entry.Hostname); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
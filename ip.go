@@ -0,0 +1,89 @@
+package go_hostctl
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseIP parses an address and reports if it is written as an IPv4-mapped
+// IPv6 address (::ffff:a.b.c.d), net.IP holds both forms the same way
+func parseIP(text string) (net.IP, bool) {
+	ip := net.ParseIP(text)
+	if ip == nil {
+		return nil, false
+	}
+	return ip, ip.To4() != nil && strings.Contains(text, ":")
+}
+
+// parseAddress parses an address that may have an IPv6 zone identifier
+// (fe80::1%eth0) and returns the address, the zone and if it is written as an
+// IPv4-mapped IPv6 address
+func parseAddress(text string) (net.IP, string, bool) {
+
+	zone := ""
+	if n := strings.IndexByte(text, '%'); n >= 0 {
+		text, zone = text[:n], text[n+1:]
+		if len(zone) == 0 {
+			return nil, "", false
+		}
+	}
+
+	ip, mapped := parseIP(text)
+	if ip == nil {
+		return nil, "", false
+	}
+	return ip, zone, mapped
+}
+
+// validateZone checks the zone identifier is an interface name or index on an IPv6 address
+func (he *HostEntry) validateZone() error {
+
+	if len(he.Zone) == 0 {
+		return nil
+	}
+
+	if he.IPAddress.To4() != nil {
+		return fmt.Errorf("zone %s is only valid for IPv6 addresses: %s", he.Zone, he.IPAddress)
+	}
+
+	for _, r := range he.Zone {
+		if r <= ' ' || r >= utf8.RuneSelf || r == '%' || r == '#' {
+			return fmt.Errorf("invalid character %q in zone: %s", r, he.Zone)
+		}
+	}
+
+	return nil
+}
+
+// ipString renders the entry address keeping the IPv4-mapped IPv6 form and the zone
+func (he *HostEntry) ipString() string {
+	if he.mapped && he.IPAddress.To4() != nil {
+		return "::ffff:" + he.IPAddress.To4().String()
+	}
+
+	if len(he.Zone) != 0 {
+		return he.IPAddress.String() + "%" + he.Zone
+	}
+	return he.IPAddress.String()
+}
+
+// ipEqual compares addresses by value so every textual form of an IPv6
+// address is equal, an IPv4-mapped IPv6 address only equals its IPv4 address
+// when mappedEqual is set
+func ipEqual(a net.IP, aMapped bool, b net.IP, bMapped bool, mappedEqual bool) bool {
+	if a == nil || b == nil || !a.Equal(b) {
+		return false
+	}
+	return mappedEqual || aMapped == bMapped
+}
+
+// WithIPv4MappedEqual makes IP lookups treat an IPv4-mapped IPv6 address such
+// as ::ffff:127.0.0.1 as equal to its IPv4 address
+func WithIPv4MappedEqual() Option {
+	return func(hfc *hostsFileCtl) error {
+		hfc.mappedEqual = true
+		return nil
+	}
+}
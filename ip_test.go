@@ -0,0 +1,126 @@
+package go_hostctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostsFileCtl_GetIPNormalized(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := hctl.GetIP("0:0:0:0:0:0:0:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Hostname != "localhost" {
+		t.Fatalf("expecting ::1 localhost, got: %v", entries)
+	}
+
+	// IPv4-mapped addresses are distinct unless asked otherwise
+	entries, err = hctl.GetIP("::ffff:127.0.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expecting no entries, got: %v", entries)
+	}
+
+	hctl, err = NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithIPv4MappedEqual())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = hctl.GetIP("::ffff:127.0.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Hostname != "some_macos.local" {
+		t.Fatalf("expecting some_macos.local, got: %v", entries)
+	}
+}
+
+func TestHostsFileCtl_IPv4Mapped(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("::FFFF:10.1.1.1 mapped.host\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := hctl.GetIP("::ffff:10.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].String() != "::ffff:10.1.1.1\tmapped.host" {
+		t.Fatalf("expecting the mapped form to be kept, got: %v", entries)
+	}
+
+	entries, err = hctl.GetIP("10.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expecting no entries, got: %v", entries)
+	}
+}
+
+func TestHostsFileCtl_IPv6Zone(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("fe80::1%eth0 router.local\nfe80::1%wlan0 router.wlan\nfe80::1 router.any\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := hctl.GetIP("fe80::1%eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Zone != "eth0" || entries[0].String() != "fe80::1%eth0\trouter.local" {
+		t.Fatalf("expecting router.local with its zone, got: %v", entries)
+	}
+
+	entries, err = hctl.GetIP("FE80:0::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hostnames(entries); strings.Join(got, " ") != "router.local router.wlan router.any" {
+		t.Fatalf("expecting every fe80::1 entry without a zone, got: %v", got)
+	}
+
+	entry, err := NewHostEntry("fe80::2%2", "router.index", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.IPAddress.String() != "fe80::2" || entry.Zone != "2" || entry.String() != "fe80::2%2\trouter.index" {
+		t.Fatalf("expecting a zone index, got: %v", entry)
+	}
+
+	for _, ip := range []string{"10.0.0.1%eth0", "fe80::1%", "fe80::1%eth 0"} {
+		if _, err := NewHostEntry(ip, "router.local", ""); err == nil {
+			t.Fatalf("%s: expecting an invalid address error", ip)
+		}
+	}
+
+	if err := hctl.Read(strings.NewReader("10.0.0.1%eth0 router.local\n")); err == nil {
+		t.Fatalf("expecting a zone on an IPv4 address to be rejected")
+	}
+}
@@ -0,0 +1,94 @@
+package go_hostctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// hostEntryJSON is the JSON schema of a HostEntry, every field is always present
+type hostEntryJSON struct {
+	Position  int      `json:"position"`
+	IP        string   `json:"ip"`
+	Hostname  string   `json:"hostname"`
+	Aliases   []string `json:"aliases"`
+	Comment   string   `json:"comment"`
+	IsComment bool     `json:"is_comment"`
+	Disabled  bool     `json:"disabled"`
+	Unparsed  bool     `json:"unparsed"`
+}
+
+// MarshalJSON encodes the entry using the schema documented in the README
+func (he HostEntry) MarshalJSON() ([]byte, error) {
+
+	ip := ""
+	if he.IPAddress != nil {
+		ip = he.ipString()
+	}
+
+	aliases := he.Aliases
+	if aliases == nil {
+		aliases = make([]string, 0)
+	}
+
+	return json.Marshal(hostEntryJSON{
+		Position:  he.Position,
+		IP:        ip,
+		Hostname:  he.Hostname,
+		Aliases:   aliases,
+		Comment:   he.Comment,
+		IsComment: he.isComment,
+		Disabled:  he.Disabled,
+		Unparsed:  he.unparsed,
+	})
+}
+
+// UnmarshalJSON decodes and validates an entry
+func (he *HostEntry) UnmarshalJSON(data []byte) error {
+
+	var decoded hostEntryJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	// Lines kept by lenient mode hold the line in the comment
+	if decoded.Unparsed {
+		entry := unparsedLine([]byte(decoded.Comment))
+		entry.Position = decoded.Position
+		*he = *entry
+		return nil
+	}
+
+	entry := HostEntry{
+		Position: decoded.Position,
+		Comment:  decoded.Comment,
+		Hostname: decoded.Hostname,
+		Aliases:  decoded.Aliases,
+		Disabled: decoded.Disabled,
+	}
+
+	if len(decoded.IP) != 0 {
+		entry.IPAddress, entry.Zone, entry.mapped = parseAddress(decoded.IP)
+		if entry.IPAddress == nil {
+			return fmt.Errorf("invalid ip address: %s", decoded.IP)
+		}
+	}
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	*he = entry
+	return nil
+}
+
+// WriteJSONLines writes every entry as a JSON object on its own line
+func WriteJSONLines(writer io.Writer, entries []HostEntry) error {
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHostEntry_JSON(t *testing.T) {
+
+	out, err := json.Marshal(hostEntry1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"position":0,"ip":"1.1.1.1","hostname":"host_one","aliases":["h1"],"comment":"# host entry one","is_comment":false,"disabled":false,"unparsed":false}`
+	if string(out) != expected {
+		t.Fatalf("expecting %s, got: %s", expected, out)
+	}
+
+	var entry HostEntry
+	if err := json.Unmarshal(out, &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.String() != hostEntry1.String() {
+		t.Fatalf("expecting %s, got: %s", hostEntry1.String(), entry.String())
+	}
+
+	if err := json.Unmarshal([]byte(`{"ip":"not_an_ip","hostname":"host"}`), &entry); err == nil {
+		t.Fatalf("expecting invalid ip address to be rejected")
+	}
+}
+
+func TestWriteJSONLines(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := WriteJSONLines(buf, hctl.Entries()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(hctl.Entries()) {
+		t.Fatalf("expecting one line per entry, got: %d", len(lines))
+	}
+
+	if !strings.Contains(lines[0], `"is_comment":true`) {
+		t.Fatalf("expecting first entry to be a comment line, got: %s", lines[0])
+	}
+}
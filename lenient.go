@@ -0,0 +1,102 @@
+package go_hostctl
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Diagnostic describes a line that could not be parsed in lenient mode.
+// Lines and columns start at 1, columns count bytes.
+type Diagnostic struct {
+	Line   int
+	Column int
+	Reason string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Reason)
+}
+
+// WithLenient keeps lines that cannot be parsed as unparsed entries instead
+// of failing, see Diagnostics. Unparsed entries are written back as they were
+// read and are ignored by lookups.
+func WithLenient() Option {
+	return func(hfc *hostsFileCtl) error {
+		hfc.lenient = true
+		return nil
+	}
+}
+
+// Unparsed reports if the entry is a line kept as is by lenient mode
+func (he HostEntry) Unparsed() bool {
+	return he.unparsed
+}
+
+// fieldError is an error about a whitespace separated field of a line, the
+// first field being the ip address
+type fieldError struct {
+	field int
+	err   error
+}
+
+func (fe *fieldError) Error() string {
+	return fe.err.Error()
+}
+
+func (fe *fieldError) Unwrap() error {
+	return fe.err
+}
+
+// fieldColumn returns the column of a whitespace separated field of the line
+func fieldColumn(line []byte, field int) int {
+
+	current, inField := -1, false
+	for offset := 0; offset < len(line); {
+		r, size := utf8.DecodeRune(line[offset:])
+		if unicode.IsSpace(r) {
+			inField = false
+		} else if !inField {
+			inField = true
+			if current++; current == field {
+				return offset + 1
+			}
+		}
+		offset += size
+	}
+
+	return 1
+}
+
+// unparsedLine returns the entry keeping a line that could not be parsed as is
+func unparsedLine(line []byte) *HostEntry {
+	return &HostEntry{
+		rawLine:   append([]byte{}, line...),
+		isComment: true,
+		unparsed:  true,
+		Comment:   string(line),
+		Aliases:   make([]string, 0),
+	}
+}
+
+// diagnose returns the diagnostic for a line that could not be parsed
+func diagnose(line []byte, lineNumber int, err error) Diagnostic {
+
+	column := 1
+	if fe, ok := err.(*fieldError); ok {
+		column = fieldColumn(line, fe.field)
+	}
+
+	return Diagnostic{Line: lineNumber, Column: column, Reason: err.Error()}
+}
+
+// Diagnostics returns the lines that could not be parsed in lenient mode.
+// Lines of the hosts file are numbered from its start, lines given to Read
+// from the start of what was read.
+func (hfc *hostsFileCtl) Diagnostics() []Diagnostic {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	return append([]Diagnostic{}, hfc.diagnostics...)
+}
@@ -0,0 +1,184 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const brokenHosts = "127.0.0.1 localhost\n" +
+	"\n" +
+	"300.1.1.1 bad.example # not an address\n" +
+	"10.0.0.1  good.example  bad%alias\n" +
+	"10.0.0.2 web.example\n"
+
+func TestHostsFileCtl_Lenient(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_Lenient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString(brokenHosts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHostFileCtl(f.Name()); err == nil || !strings.Contains(err.Error(), "line 3 - invalid ip address: 300.1.1.1") {
+		t.Fatalf("expecting line 3 to be rejected without lenient mode, got: %v", err)
+	}
+
+	for _, lossless := range []bool{true, false} {
+
+		options := []Option{WithLenient()}
+		if lossless {
+			options = append(options, WithLossless())
+		}
+
+		hctl, err := NewHostFileCtl(f.Name(), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Diagnostic{
+			{Line: 3, Column: 1, Reason: "invalid ip address: 300.1.1.1"},
+			{Line: 4, Column: 25, Reason: `alias 1: invalid name "bad%alias": invalid character '%' at offset 3, only letters, digits, dots, hyphens and underscores are allowed`},
+		}
+		if diagnostics := hctl.Diagnostics(); !reflect.DeepEqual(diagnostics, expected) {
+			t.Fatalf("lossless %t: expecting diagnostics %v, got: %v", lossless, expected, diagnostics)
+		}
+
+		entries := hctl.Entries()
+		if len(entries) != 4 || !entries[1].Unparsed() || !entries[2].Unparsed() || entries[3].Unparsed() {
+			t.Fatalf("lossless %t: expecting lines 3 and 4 to be unparsed, got: %v", lossless, entries)
+		}
+
+		// Unparsed lines are never matched
+		if found, err := hctl.GetHostname("good.example"); err != nil || len(found) != 0 {
+			t.Fatalf("lossless %t: expecting no match for an unparsed line, got: %v, %v", lossless, found, err)
+		}
+
+		if err := hctl.Add(HostEntry{IPAddress: []byte{10, 0, 0, 3}, Hostname: "db.example"}, -1); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if _, err := hctl.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range []string{"300.1.1.1 bad.example # not an address", "10.0.0.1  good.example  bad%alias"} {
+			if !strings.Contains(buf.String(), line) {
+				t.Fatalf("lossless %t: expecting %q to be written back untouched, got: %s", lossless, line, buf.String())
+			}
+		}
+
+		if lossless && buf.String() != brokenHosts+"10.0.0.3\tdb.example\n" {
+			t.Fatalf("expecting only the added line to change, got: %q", buf.String())
+		}
+	}
+}
+
+func TestHostsFileCtl_LenientRead(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_LenientRead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLenient(), WithNameValidator(StrictNames))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.0.0.1 web.example\n10.0.0.2\tdb.example some_alias\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := hctl.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 2 || diagnostics[0].Column != 21 ||
+		!strings.HasPrefix(diagnostics[0].String(), `2:21: alias 1: invalid name "some_alias"`) {
+		t.Fatalf("expecting the alias to be reported, got: %v", diagnostics)
+	}
+
+	if err := hctl.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diagnostics := hctl.Diagnostics(); len(diagnostics) != 0 {
+		t.Fatalf("expecting no diagnostics once the read is undone, got: %v", diagnostics)
+	}
+
+	if err := hctl.Redo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diagnostics := hctl.Diagnostics(); len(diagnostics) != 1 {
+		t.Fatalf("expecting the diagnostic back once the read is redone, got: %v", diagnostics)
+	}
+
+	// Unparsed entries survive a JSON round trip
+	entry := hctl.Entries()[1]
+	data, err := entry.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded HostEntry
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.Unparsed() || decoded.String() != entry.String() {
+		t.Fatalf("expecting %q back, got: %q", entry.String(), decoded.String())
+	}
+}
+
+func TestHostsFileCtl_LenientRestore(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestHostsFileCtl_LenientRestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostsFile, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(hostsFile, WithLenient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backups are validated before they are swapped in whatever the mode
+	invalid := filepath.Join(dir, "hosts.bak.invalid")
+	if err := ioutil.WriteFile(invalid, []byte(brokenHosts), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Restore(invalid); err == nil || !strings.Contains(err.Error(), "line 3 - invalid ip address: 300.1.1.1") {
+		t.Fatalf("expecting the invalid backup to be rejected, got: %v", err)
+	}
+
+	if _, err := hctl.DiffBackup(invalid); err == nil {
+		t.Fatalf("expecting the invalid backup to be rejected by DiffBackup")
+	}
+
+	contents, err := ioutil.ReadFile(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(contents) != "127.0.0.1 localhost\n" || len(hctl.Entries()) != 1 {
+		t.Fatalf("expecting the hosts file to be left alone, got: %q", contents)
+	}
+}
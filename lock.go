@@ -0,0 +1,77 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	DefaultLockTimeout = 10 * time.Second
+	lockRetryInterval  = 10 * time.Millisecond
+)
+
+var (
+	ErrLockTimeout = errors.New("timed out waiting for hosts file lock")
+)
+
+// WithLockTimeout sets how long to wait for a lock held by another process
+// before giving up with ErrLockTimeout, zero fails straight away
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(hfc *hostsFileCtl) error {
+		if timeout < 0 {
+			return fmt.Errorf("invalid lock timeout: %s", timeout)
+		}
+		hfc.lockTimeout = timeout
+		return nil
+	}
+}
+
+// WithLockFile locks a separate file, created if missing, instead of the hosts
+// file itself so processes that do not use this library can share the lock
+func WithLockFile(path string) Option {
+	return func(hfc *hostsFileCtl) error {
+		if len(path) == 0 {
+			return fmt.Errorf("invalid lock file, empty path")
+		}
+		hfc.lockFile = path
+		return nil
+	}
+}
+
+// lock takes a shared (read) or exclusive (write) advisory lock that is held
+// until the returned func is called
+func (hfc *hostsFileCtl) lock(exclusive bool) (func(), error) {
+
+	path := hfc.lockFile
+	if len(path) == 0 {
+		path = hfc.hostsFile
+	}
+
+	f, err := acquireLock(path, exclusive, hfc.lockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	return func() {
+		releaseLock(f)
+	}, nil
+}
+
+// sameFile reports if the open file is still the one found at path, it is not
+// once the path was replaced by a rename
+func sameFile(f *os.File, path string) bool {
+
+	pathStat, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	fileStat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(pathStat, fileStat)
+}
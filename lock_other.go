@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package go_hostctl
+
+import (
+	"os"
+	"time"
+)
+
+// acquireLock is a no-op, flock is not available on this platform
+func acquireLock(path string, exclusive bool, timeout time.Duration) (*os.File, error) {
+	return nil, nil
+}
+
+func releaseLock(f *os.File) {}
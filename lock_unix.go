@@ -0,0 +1,58 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package go_hostctl
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// acquireLock opens path and flocks it, polling until timeout if another
+// process holds a conflicting lock
+func acquireLock(path string, exclusive bool, timeout time.Duration) (*os.File, error) {
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		err = syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+
+			// A Sync by another process may have renamed a new file over the one
+			// we locked while we were waiting, the lock would protect nothing
+			if sameFile(f, path) {
+				return f, nil
+			}
+
+			f.Close()
+			continue
+		}
+		f.Close()
+
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func releaseLock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	f.Close()
+}
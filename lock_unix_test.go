@@ -0,0 +1,81 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package go_hostctl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHostsFileCtl_Lock(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestHostsFileCtl_Lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	lockFile := filepath.Join(dir, "hosts.lock")
+
+	hctl, err := NewHostFileCtl(hostsFile, WithLockFile(lockFile), WithLockTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process holding the lock
+	held, err := acquireLock(lockFile, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expecting lock timeout error, got: %v", err)
+	}
+
+	if _, err := NewHostFileCtl(hostsFile, WithLockFile(lockFile), WithLockTimeout(0)); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expecting lock timeout error, got: %v", err)
+	}
+
+	releaseLock(held)
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLock_Replaced(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "TestAcquireLock_Replaced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	hctl, err := NewHostFileCtl(hostsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	held, err := acquireLock(hostsFile, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replacing the file makes the held lock stale
+	if _, err := replaceFile(hostsFile, hctl.Write); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatalf("expecting the lock on the replaced file to be ignored, got: %v", err)
+	}
+
+	releaseLock(held)
+}
@@ -0,0 +1,102 @@
+package go_hostctl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CanonicalName returns the form names are compared in: lowercase, without
+// the trailing dot of a fully qualified name and with internationalized
+// labels in punycode (xn--) form, as the resolver does
+func CanonicalName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(Normalize(&name)), ".")
+	if ascii, err := ToASCIIName(name); err == nil {
+		return ascii
+	}
+	return name
+}
+
+// NamesEqual reports if two hostnames or aliases refer to the same name
+func NamesEqual(a, b string) bool {
+	return CanonicalName(a) == CanonicalName(b)
+}
+
+// canonical returns a copy of the entry with its hostname and aliases in canonical form
+func (he HostEntry) canonical() HostEntry {
+
+	if he.isComment {
+		return he
+	}
+
+	he.Hostname = CanonicalName(he.Hostname)
+	aliases := make([]string, len(he.Aliases))
+	for n, alias := range he.Aliases {
+		aliases[n] = CanonicalName(alias)
+	}
+	he.Aliases = aliases
+
+	return he
+}
+
+// WithPreserveCase writes hostnames and aliases as they were given instead of
+// in canonical form. Lookups are case-insensitive either way.
+func WithPreserveCase() Option {
+	return func(hfc *hostsFileCtl) error {
+		hfc.preserveCase = true
+		return nil
+	}
+}
+
+// output returns the entry as it is written to the file
+func (hfc *hostsFileCtl) output(entry HostEntry) HostEntry {
+	// Commented out entries are written back with the text they were read with
+	if hfc.preserveCase || entry.Disabled {
+		return entry
+	}
+	return entry.canonical()
+}
+
+// Duplicate is a name mapped again after the entry the resolver uses for it
+type Duplicate struct {
+	Name  string
+	Entry HostEntry
+	First int
+}
+
+func (d Duplicate) String() string {
+	return fmt.Sprintf("duplicate name %s at position %d, first mapped at position %d", d.Name, d.Entry.Position, d.First)
+}
+
+// Duplicates returns the names that are mapped by more than one enabled entry
+// of the same address family, in file order. Names are compared in canonical
+// form so API.internal duplicates api.internal.
+func (hfc *hostsFileCtl) Duplicates() []Duplicate {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	type nameKey struct {
+		name string
+		ipv4 bool
+	}
+
+	duplicates := make([]Duplicate, 0)
+	seen := make(map[nameKey]int)
+	for _, entry := range hfc.entries {
+
+		if entry.IPAddress == nil || entry.Disabled {
+			continue
+		}
+
+		for _, name := range append([]string{entry.Hostname}, entry.Aliases...) {
+			key := nameKey{name: CanonicalName(name), ipv4: entry.IPAddress.To4() != nil}
+			if first, ok := seen[key]; ok {
+				duplicates = append(duplicates, Duplicate{Name: name, Entry: entry, First: first})
+				continue
+			}
+			seen[key] = entry.Position
+		}
+	}
+
+	return duplicates
+}
@@ -0,0 +1,156 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalName(t *testing.T) {
+
+	tests := map[string]string{
+		"api.internal":   "api.internal",
+		"API.Internal":   "api.internal",
+		"api.internal.":  "api.internal",
+		" Localhost.\t ": "localhost",
+		".":              "",
+	}
+
+	for name, expected := range tests {
+		if got := CanonicalName(name); got != expected {
+			t.Fatalf("%q: expecting %q, got: %q", name, expected, got)
+		}
+	}
+
+	if IsValidName(".") {
+		t.Fatalf("expecting a lone dot to be invalid")
+	}
+
+	if !IsValidName("api.internal.") {
+		t.Fatalf("expecting a fully qualified name to be valid")
+	}
+}
+
+func TestHostsFileCtl_CaseInsensitive(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.1.1.1 API.Internal. Web.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := hctl.GetHostname("api.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Hostname != "API.Internal." {
+		t.Fatalf("expecting API.Internal., got: %v", entries)
+	}
+
+	entries, err = hctl.GetAlias("WEB.INTERNAL.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expecting one entry, got: %v", entries)
+	}
+
+	entry, err := hctl.Resolve("LocalHost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.IPAddress.String() != "127.0.0.1" {
+		t.Fatalf("expecting localhost to resolve to 127.0.0.1, got: %v", entry)
+	}
+
+	// Written in canonical form unless the case is preserved
+	buf := &bytes.Buffer{}
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "10.1.1.1\tapi.internal\tweb.internal\r\n") {
+		t.Fatalf("expecting the entry in canonical form, got:\n%s", buf.String())
+	}
+
+	hctl, err = NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithPreserveCase())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.1.1.1 API.Internal. Web.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "10.1.1.1\tAPI.Internal.\tWeb.internal\r\n") {
+		t.Fatalf("expecting the original case, got:\n%s", buf.String())
+	}
+}
+
+func TestHostsFileCtl_LosslessKeepsCase(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.1.1.1   API.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := NewHostEntry("10.1.1.2", "Web.Internal", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*entry, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Untouched lines are kept as read, new ones are rendered in canonical form
+	if !strings.HasSuffix(buf.String(), "10.1.1.1   API.internal\n10.1.1.2\tweb.internal\n") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestHostsFileCtl_Duplicates(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.1.1.1 Some_Server.\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, duplicate := range hctl.Duplicates() {
+		if duplicate.Name == "Some_Server." {
+			found = true
+			if duplicate.First != 23 {
+				t.Fatalf("expecting some_server first mapped at 23, got: %v", duplicate)
+			}
+		}
+	}
+
+	if !found {
+		t.Fatalf("expecting Some_Server. to be a duplicate, got: %v", hctl.Duplicates())
+	}
+}
@@ -0,0 +1,93 @@
+package go_hostctl
+
+import (
+	"fmt"
+)
+
+// Profile is a named group of entries, kept in the managed block of the same
+// name, that can be enabled and disabled as a whole
+type Profile struct {
+	Name    string
+	Entries []HostEntry
+}
+
+// Enabled reports if none of the profile entries are disabled
+func (p Profile) Enabled() bool {
+	for _, entry := range p.Entries {
+		if entry.Disabled {
+			return false
+		}
+	}
+	return true
+}
+
+// Profiles returns every managed block as a profile in file order
+func (hfc *hostsFileCtl) Profiles() ([]Profile, error) {
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	profiles := make([]Profile, 0)
+	for _, entry := range hfc.entries {
+
+		name, ok := markerName(entry, BlockBeginMarker)
+		if !ok {
+			continue
+		}
+
+		begin, end, err := hfc.findBlock(name)
+		if err != nil {
+			return nil, err
+		}
+
+		profile := Profile{
+			Name:    name,
+			Entries: make([]HostEntry, 0),
+		}
+
+		for _, blockEntry := range hfc.entries[begin+1 : end] {
+			if !blockEntry.isComment {
+				profile.Entries = append(profile.Entries, blockEntry)
+			}
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return profiles, nil
+}
+
+// EnableProfile uncomments every entry of the named profile
+func (hfc *hostsFileCtl) EnableProfile(name string) error {
+	return hfc.setProfileDisabled(name, false)
+}
+
+// DisableProfile comments out every entry of the named profile
+func (hfc *hostsFileCtl) DisableProfile(name string) error {
+	return hfc.setProfileDisabled(name, true)
+}
+
+func (hfc *hostsFileCtl) setProfileDisabled(name string, disabled bool) error {
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	begin, end, err := hfc.findBlock(name)
+	if err != nil {
+		return err
+	}
+
+	if begin < 0 {
+		return fmt.Errorf("%w: %s", ErrBlockNotFound, name)
+	}
+
+	hfc.forget()
+	for n := begin + 1; n < end; n++ {
+		if !hfc.entries[n].isComment {
+			hfc.entries[n].Disabled = disabled
+			hfc.entries[n].format()
+		}
+	}
+
+	return nil
+}
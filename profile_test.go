@@ -0,0 +1,159 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseHostEntryLine_Disabled(t *testing.T) {
+
+	entry, err := ParseHostEntryLine([]byte("# 10.0.0.1\tapi.internal\tapi\t# staging"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !entry.Disabled || entry.IPAddress.String() != "10.0.0.1" || entry.Hostname != "api.internal" {
+		t.Fatalf("expecting a disabled entry for api.internal, got: %v", entry)
+	}
+
+	if entry.String() != "# 10.0.0.1\tapi.internal\tapi\t# staging" {
+		t.Fatalf("unexpected disabled entry rendering: %s", entry.String())
+	}
+
+	entry, err = ParseHostEntryLine([]byte("# localhost is used to configure the loopback interface"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Disabled || !entry.isComment {
+		t.Fatalf("expecting a plain comment, got: %v", entry)
+	}
+
+	// Comments that only start with an address are prose, not disabled entries
+	for _, line := range []string{"# 192.168.1.1 is the router", "#  10.0.0.1 api.internal api # staging", "#10.0.0.1\tapi.internal"} {
+		entry, err = ParseHostEntryLine([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Disabled || !entry.isComment || entry.String() != line {
+			t.Fatalf("expecting %q to be a plain comment, got: %v", line, entry)
+		}
+	}
+}
+
+func TestHostsFileCtl_ProseComment(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_ProseComment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	contents := "# 192.168.1.1 is the Router\n# 10.0.0.1\tAPI.internal\tapi\n192.168.1.1\trouter\n"
+	if _, err := f.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := hctl.GetHostname("is"); err != nil || len(found) != 0 {
+		t.Fatalf("expecting the prose comment not to be an entry, got: %v, %v", found, err)
+	}
+
+	if found, err := hctl.GetAlias("router"); err != nil || len(found) != 0 {
+		t.Fatalf("expecting the prose comment not to be an entry, got: %v, %v", found, err)
+	}
+
+	// Comments and untoggled disabled entries are written back as they were read
+	buf := bytes.NewBuffer(nil)
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	written := strings.TrimLeft(strings.Replace(buf.String(), CarriageReturnLineFeed, LineFeed, -1), LineFeed)
+	if written != contents {
+		t.Fatalf("expecting %q, got: %q", contents, written)
+	}
+
+	disabled, err := hctl.GetFirstHostname("api.internal")
+	if err == nil || len(hctl.Entries()) != 3 || !hctl.Entries()[1].Disabled {
+		t.Fatalf("expecting a disabled entry for api.internal, got: %v, %v", disabled, err)
+	}
+}
+
+func TestHostsFileCtl_Profiles(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.ReplaceBlock("staging", []HostEntry{*hostEntry1, *hostEntry2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.DisableProfile("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if _, err := hctl.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Toggled entries render as they are written
+	disabled, err := hctl.Block("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range disabled {
+		if !entry.Disabled || !strings.HasPrefix(entry.String(), "# ") || !strings.Contains(buf.String(), entry.String()) {
+			t.Fatalf("expecting a commented out entry as written, got: %q", entry.String())
+		}
+	}
+
+	// Parse the written output back and make sure the profile survived disabled
+	check, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := check.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := check.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(profiles) != 1 || profiles[0].Name != "staging" || len(profiles[0].Entries) != 2 || profiles[0].Enabled() {
+		t.Fatalf("expecting a disabled staging profile with two entries, got: %v", profiles)
+	}
+
+	if err := check.EnableProfile("staging"); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err = check.Profiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !profiles[0].Enabled() || profiles[0].Entries[0].Hostname != hostEntry1.Hostname {
+		t.Fatalf("expecting an enabled staging profile, got: %v", profiles)
+	}
+
+	if rendered := profiles[0].Entries[0].String(); rendered != hostEntry1.String() {
+		t.Fatalf("expecting %q once enabled again, got: %q", hostEntry1.String(), rendered)
+	}
+}
@@ -0,0 +1,174 @@
+package go_hostctl
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ipRange is an inclusive range of addresses of one family
+type ipRange struct {
+	first  net.IP
+	last   net.IP
+	mapped bool
+}
+
+// parseRange parses a CIDR (10.0.0.0/8) or an inclusive range (10.0.0.1-10.0.0.50)
+func parseRange(query string) (*ipRange, error) {
+
+	if strings.Contains(query, "/") {
+		_, network, err := net.ParseCIDR(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr specified: %s", query)
+		}
+
+		last := make(net.IP, len(network.IP))
+		for n := range network.IP {
+			last[n] = network.IP[n] | ^network.Mask[n]
+		}
+
+		_, mapped := parseIP(query[:strings.Index(query, "/")])
+		return &ipRange{first: network.IP.To16(), last: last.To16(), mapped: mapped}, nil
+	}
+
+	bounds := strings.Split(query, "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid ip range specified: %s", query)
+	}
+
+	first, firstMapped := parseIP(strings.TrimSpace(bounds[0]))
+	last, lastMapped := parseIP(strings.TrimSpace(bounds[1]))
+	if first == nil || last == nil || (first.To4() == nil) != (last.To4() == nil) || firstMapped != lastMapped {
+		return nil, fmt.Errorf("invalid ip range specified: %s", query)
+	}
+
+	if bytes.Compare(first.To16(), last.To16()) > 0 {
+		return nil, fmt.Errorf("invalid ip range specified, start after end: %s", query)
+	}
+
+	return &ipRange{first: first.To16(), last: last.To16(), mapped: firstMapped}, nil
+}
+
+// contains reports if the address is in the range, IPv4 addresses are never
+// in an IPv6 range and an IPv4-mapped IPv6 address is only in an IPv4 range
+// (and the other way around) when mappedEqual is set
+func (r *ipRange) contains(ip net.IP, mapped bool, mappedEqual bool) bool {
+
+	if ip == nil {
+		return false
+	}
+
+	if r.first.To4() != nil {
+		if ip.To4() == nil || (!mappedEqual && mapped != r.mapped) {
+			return false
+		}
+	} else if ip.To4() != nil && !mapped {
+		return false
+	}
+
+	ip = ip.To16()
+	return bytes.Compare(ip, r.first) >= 0 && bytes.Compare(ip, r.last) <= 0
+}
+
+// GetRange returns the entries, in file order, with an address in the CIDR
+// (10.0.0.0/8) or inclusive range (10.0.0.1-10.0.0.50)
+func (hfc *hostsFileCtl) GetRange(query string) ([]HostEntry, error) {
+
+	r, err := parseRange(query)
+	if err != nil {
+		return nil, err
+	}
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	entries := make([]HostEntry, 0)
+	for _, entry := range hfc.entries {
+		if r.contains(entry.IPAddress, entry.mapped, hfc.mappedEqual) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// NameQuery is a glob (*.internal) or regular expression pattern matched
+// against the hostname and aliases of entries
+type NameQuery struct {
+	Pattern         string
+	Regex           bool
+	CaseInsensitive bool
+}
+
+// NameMatch is an entry found by FindNames and the hostname or alias that matched
+type NameMatch struct {
+	Entry HostEntry
+	Name  string
+}
+
+// matcher returns a function reporting if a name matches the query, glob
+// patterns must match the whole name while regular expressions can be anchored
+func (nq NameQuery) matcher() (func(name string) bool, error) {
+
+	if nq.Regex {
+		pattern := nq.Pattern
+		if nq.CaseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %s", err)
+		}
+		return re.MatchString, nil
+	}
+
+	pattern := nq.Pattern
+	if nq.CaseInsensitive {
+		pattern = strings.ToLower(pattern)
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern: %s", nq.Pattern)
+	}
+
+	return func(name string) bool {
+		if nq.CaseInsensitive {
+			name = strings.ToLower(name)
+		}
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// FindNames returns the entries, in file order, with a hostname or alias
+// matching the query along with the first name that matched
+func (hfc *hostsFileCtl) FindNames(query NameQuery) ([]NameMatch, error) {
+
+	match, err := query.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	hfc.rwLck.RLock()
+	defer hfc.rwLck.RUnlock()
+
+	matches := make([]NameMatch, 0)
+	for _, entry := range hfc.entries {
+		if entry.isComment {
+			continue
+		}
+
+		for _, name := range append([]string{entry.Hostname}, entry.Aliases...) {
+			if match(name) {
+				matches = append(matches, NameMatch{Entry: entry, Name: name})
+				break
+			}
+		}
+	}
+
+	return matches, nil
+}
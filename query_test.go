@@ -0,0 +1,137 @@
+package go_hostctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHostsFileCtl_GetRange(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query     string
+		hostnames []string
+	}{
+		{query: "12.0.0.0/8", hostnames: []string{"host_entry_1", "host_entry_2", "host_entry_4", "host_entry_4", "host_entry_4"}},
+		{query: "12.12.12.13-12.12.12.20", hostnames: []string{"host_entry_4", "host_entry_4"}},
+		{query: "127.0.1.1/32", hostnames: []string{"some_macos.local"}},
+		{query: "::/64", hostnames: []string{"localhost"}},
+		{query: "192.168.0.0/16", hostnames: []string{}},
+	}
+
+	for _, test := range tests {
+		entries, err := hctl.GetRange(test.query)
+		if err != nil {
+			t.Fatalf("%s: %s", test.query, err)
+		}
+
+		if got := hostnames(entries); strings.Join(got, " ") != strings.Join(test.hostnames, " ") {
+			t.Fatalf("%s: expecting %v, got: %v", test.query, test.hostnames, got)
+		}
+	}
+
+	for _, query := range []string{"", "10.0.0.0/33", "10.0.0.1", "10.0.0.1-::1", "10.0.0.2-10.0.0.1", "a-b"} {
+		if _, err := hctl.GetRange(query); err == nil {
+			t.Fatalf("%s: expecting an error", query)
+		}
+	}
+}
+
+func TestHostsFileCtl_GetRangeIPv4Mapped(t *testing.T) {
+
+	for _, mappedEqual := range []bool{false, true} {
+
+		opts := []Option{}
+		if mappedEqual {
+			opts = append(opts, WithIPv4MappedEqual())
+		}
+
+		hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := hctl.Read(strings.NewReader("::ffff:10.1.1.1 mapped.host\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err := hctl.GetRange("10.0.0.0/8")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"localhost.localdomain"}
+		if mappedEqual {
+			expected = append(expected, "mapped.host")
+		}
+
+		if got := hostnames(entries); strings.Join(got, " ") != strings.Join(expected, " ") {
+			t.Fatalf("mapped equal %v: expecting %v, got: %v", mappedEqual, expected, got)
+		}
+
+		entries, err = hctl.GetRange("::ffff:10.0.0.0/104")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected = []string{"mapped.host"}
+		if mappedEqual {
+			expected = []string{"localhost.localdomain", "mapped.host"}
+		}
+
+		if got := hostnames(entries); strings.Join(got, " ") != strings.Join(expected, " ") {
+			t.Fatalf("mapped equal %v: expecting %v, got: %v", mappedEqual, expected, got)
+		}
+	}
+}
+
+func TestHostsFileCtl_FindNames(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Read(strings.NewReader("10.1.1.1 api.Dev.local web.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query NameQuery
+		names []string
+	}{
+		{query: NameQuery{Pattern: "*.local"}, names: []string{"some_macos.local", "api.Dev.local"}},
+		{query: NameQuery{Pattern: "*.dev.local"}, names: []string{}},
+		{query: NameQuery{Pattern: "*.dev.local", CaseInsensitive: true}, names: []string{"api.Dev.local"}},
+		{query: NameQuery{Pattern: "*.internal"}, names: []string{"kubernetes.docker.internal", "web.internal"}},
+		{query: NameQuery{Pattern: "h?"}, names: []string{"h0", "h0", "h0", "h0", "h0", "h0"}},
+		{query: NameQuery{Pattern: `^local`, Regex: true}, names: []string{"localhost", "localhost", "localhost.localdomain"}},
+		{query: NameQuery{Pattern: `\.DEV\.`, Regex: true, CaseInsensitive: true}, names: []string{"api.Dev.local"}},
+	}
+
+	for _, test := range tests {
+		matches, err := hctl.FindNames(test.query)
+		if err != nil {
+			t.Fatalf("%s: %s", test.query.Pattern, err)
+		}
+
+		names := make([]string, len(matches))
+		for n, match := range matches {
+			names[n] = match.Name
+		}
+
+		if strings.Join(names, " ") != strings.Join(test.names, " ") {
+			t.Fatalf("%s: expecting %v, got: %v", test.query.Pattern, test.names, names)
+		}
+	}
+
+	for _, query := range []NameQuery{{Pattern: "[a"}, {Pattern: "(", Regex: true}} {
+		if _, err := hctl.FindNames(query); err == nil {
+			t.Fatalf("%s: expecting an error", query.Pattern)
+		}
+	}
+}
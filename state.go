@@ -0,0 +1,166 @@
+package go_hostctl
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// snapshot is the parsed contents of the hosts file as found on disk
+type snapshot struct {
+	entries     []HostEntry
+	trailing    []byte
+	eol         []byte
+	diagnostics []Diagnostic
+	hash        [sha256.Size]byte
+}
+
+// ConflictError is returned by Sync when the hosts file was modified by
+// someone else since it was loaded, see Rebase
+type ConflictError struct {
+	Path string
+}
+
+func (ce *ConflictError) Error() string {
+	return fmt.Sprintf("hosts file was modified externally since it was loaded: %s", ce.Path)
+}
+
+// reset replaces all entries with the snapshot and makes it the new base
+func (hfc *hostsFileCtl) reset(snap *snapshot) {
+
+	hfc.entries = snap.entries
+	hfc.trailing = snap.trailing
+	hfc.eol = snap.eol
+	hfc.diagnostics = snap.diagnostics
+	hfc.forget()
+	hfc.updatePosition()
+
+	hfc.base = make([]HostEntry, len(hfc.entries))
+	copy(hfc.base, hfc.entries)
+	hfc.loadedHash = snap.hash
+}
+
+// synced records the contents just written as the new base
+func (hfc *hostsFileCtl) synced(contents []byte) {
+	hfc.base = make([]HostEntry, len(hfc.entries))
+	copy(hfc.base, hfc.entries)
+	hfc.loadedHash = sha256.Sum256(contents)
+}
+
+// checkConflict compares the hosts file on disk with what was loaded and
+// returns its current contents
+func (hfc *hostsFileCtl) checkConflict() ([]byte, error) {
+
+	contents, err := ioutil.ReadFile(hfc.hostsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &ConflictError{Path: hfc.hostsFile}
+		}
+		return nil, err
+	}
+
+	if sha256.Sum256(contents) != hfc.loadedHash {
+		return nil, &ConflictError{Path: hfc.hostsFile}
+	}
+
+	return contents, nil
+}
+
+// Rebase reloads the hosts file from disk and replays the in-memory edits made
+// since it was loaded (or last synced) on top of it, see MergeEntries
+func (hfc *hostsFileCtl) Rebase() error {
+
+	snap, err := hfc.load()
+	if err != nil {
+		return err
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	merged := MergeEntries(hfc.base, hfc.entries, snap.entries)
+	hfc.reset(snap)
+	hfc.entries = merged
+	hfc.updatePosition()
+	return nil
+}
+
+// mergeKey identifies an entry by its rendered form
+func mergeKey(entry HostEntry) string {
+	rendered, err := entry.render()
+	if err != nil {
+		return string(entry.rawLine)
+	}
+	return string(rendered)
+}
+
+// MergeEntries performs a three-way merge of entry lists: the entries removed
+// from base in ours are removed from theirs and the entries added in ours are
+// inserted into theirs after the entry that preceded them in ours, or appended
+// when that entry no longer exists. Entries are compared by their rendered
+// form so a modified entry is treated as a removal plus an addition.
+func MergeEntries(base, ours, theirs []HostEntry) []HostEntry {
+
+	baseCount := make(map[string]int)
+	for _, entry := range base {
+		baseCount[mergeKey(entry)]++
+	}
+
+	oursCount := make(map[string]int)
+	for _, entry := range ours {
+		oursCount[mergeKey(entry)]++
+	}
+
+	// Drop what we removed
+	removed := make(map[string]int)
+	for key, count := range baseCount {
+		if count > oursCount[key] {
+			removed[key] = count - oursCount[key]
+		}
+	}
+
+	merged := make([]HostEntry, 0, len(theirs))
+	for _, entry := range theirs {
+		key := mergeKey(entry)
+		if removed[key] > 0 {
+			removed[key]--
+			continue
+		}
+		merged = append(merged, entry)
+	}
+
+	// Insert what we added next to its preceding entry
+	seen := make(map[string]int)
+	inserted := -2 // position in merged of the previous entry of ours if it was an addition
+	for n, entry := range ours {
+
+		key := mergeKey(entry)
+		seen[key]++
+		if seen[key] <= baseCount[key] {
+			inserted = -2
+			continue
+		}
+
+		position := len(merged)
+		switch {
+		case inserted != -2:
+			position = inserted + 1
+		case n == 0:
+			position = 0
+		default:
+			anchor := mergeKey(ours[n-1])
+			for m, candidate := range merged {
+				if mergeKey(candidate) == anchor {
+					position = m + 1
+					break
+				}
+			}
+		}
+
+		merged = append(merged[:position], append([]HostEntry{entry}, merged[position:]...)...)
+		inserted = position
+	}
+
+	return merged
+}
@@ -0,0 +1,87 @@
+package go_hostctl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func hostnames(entries []HostEntry) []string {
+	names := make([]string, len(entries))
+	for n, entry := range entries {
+		names[n] = entry.Hostname
+	}
+	return names
+}
+
+func TestMergeEntries(t *testing.T) {
+
+	base := []HostEntry{*hostEntry1, *hostEntry2, *hostEntry3}
+	ours := []HostEntry{*hostEntry1, *hostEntry3, *hostEntry4}
+
+	external, err := NewHostEntry("5.5.5.5", "host_five", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := []HostEntry{*hostEntry1, *hostEntry2, *external, *hostEntry3}
+
+	merged := MergeEntries(base, ours, theirs)
+
+	expected := []string{"host_one", "host_five", "host_three", "host_four"}
+	if !reflect.DeepEqual(hostnames(merged), expected) {
+		t.Fatalf("expecting %v, got: %v", expected, hostnames(merged))
+	}
+}
+
+func TestHostsFileCtl_SyncConflict(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_SyncConflict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString("1.1.1.1 host_one\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*hostEntry2, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else edits the file in the meantime
+	if err := ioutil.WriteFile(f.Name(), []byte("1.1.1.1 host_one\n3.3.3.3 host_three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var conflict *ConflictError
+	if _, err := hctl.Sync(); !errors.As(err, &conflict) {
+		t.Fatalf("expecting a conflict error, got: %v", err)
+	}
+
+	if err := hctl.Rebase(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hctl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "1.1.1.1 host_one\n" + hostEntry2.String() + "\n3.3.3.3 host_three\n"
+	if string(out) != expected {
+		t.Fatalf("expecting merged file:\n%s\ngot:\n%s", expected, out)
+	}
+}
@@ -0,0 +1,178 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx stages changes that are applied together by Commit, either all of them
+// are applied or none
+type Tx struct {
+	hfc  *hostsFileCtl
+	lck  sync.Mutex
+	ops  []func() error
+	done bool
+}
+
+// memState is the in-memory state of a HostFileCtl restored when a
+// transaction fails
+type memState struct {
+	entries  []HostEntry
+	trailing []byte
+	eol      []byte
+	lastID   EntryID
+	undo     []change
+	redo     []change
+}
+
+func (hfc *hostsFileCtl) save() memState {
+	return memState{
+		entries:  append([]HostEntry{}, hfc.entries...),
+		trailing: hfc.trailing,
+		eol:      hfc.eol,
+		lastID:   hfc.lastID,
+		undo:     hfc.undo,
+		redo:     hfc.redo,
+	}
+}
+
+func (hfc *hostsFileCtl) restore(state memState) {
+	hfc.entries = state.entries
+	hfc.trailing = state.trailing
+	hfc.eol = state.eol
+	hfc.lastID = state.lastID
+	hfc.undo = state.undo
+	hfc.redo = state.redo
+	hfc.index = nil
+}
+
+// Begin starts a transaction, nothing changes until it is committed
+func (hfc *hostsFileCtl) Begin() *Tx {
+	return &Tx{hfc: hfc}
+}
+
+func (tx *Tx) stage(op func() error) error {
+
+	tx.lck.Lock()
+	defer tx.lck.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// Add stages adding the entry at position, positions are those left by the
+// operations staged before
+func (tx *Tx) Add(entry HostEntry, position int) error {
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	if err := tx.hfc.validateNames(&entry); err != nil {
+		return err
+	}
+
+	if position < -1 {
+		return fmt.Errorf("invalid position: %d", position)
+	}
+
+	return tx.stage(func() error {
+		return tx.hfc.add(entry, position)
+	})
+}
+
+// Delete stages deleting the entry at position
+func (tx *Tx) Delete(position int) error {
+
+	if position < -1 {
+		return fmt.Errorf("invalid position: %d", position)
+	}
+
+	return tx.stage(func() error {
+		return tx.hfc.delete(position)
+	})
+}
+
+// Update stages replacing the entry at position
+func (tx *Tx) Update(position int, entry HostEntry) error {
+
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	if err := tx.hfc.validateNames(&entry); err != nil {
+		return err
+	}
+
+	return tx.stage(func() error {
+		return tx.hfc.update(position, entry)
+	})
+}
+
+// Commit applies the staged operations in order under one write lock and,
+// with sync, writes the result to the file. On any failure the in-memory
+// state is left as it was before the commit.
+func (tx *Tx) Commit(sync bool) error {
+
+	tx.lck.Lock()
+	defer tx.lck.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	hfc := tx.hfc
+	if sync {
+		unlock, err := hfc.lock(true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	hfc.rwLck.Lock()
+	defer hfc.rwLck.Unlock()
+
+	state := hfc.save()
+	for n, op := range tx.ops {
+		if err := op(); err != nil {
+			hfc.restore(state)
+			return fmt.Errorf("transaction operation %d - %s", n, err)
+		}
+	}
+
+	// Undo and Redo treat the transaction as a whole
+	hfc.group(len(state.undo))
+
+	if sync {
+		if _, err := hfc.sync(); err != nil {
+			hfc.restore(state)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback discards the staged operations
+func (tx *Tx) Rollback() error {
+
+	tx.lck.Lock()
+	defer tx.lck.Unlock()
+
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
@@ -0,0 +1,211 @@
+package go_hostctl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestHostsFileCtl_TxCommit(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := len(hctl.Entries())
+	tx := hctl.Begin()
+
+	if err := tx.Add(*hostEntry1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Update(1, *hostEntry2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Delete(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hctl.Entries()) != count {
+		t.Fatalf("expecting nothing to change before commit")
+	}
+
+	if err := tx.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := hctl.Entries()
+	if len(entries) != count || entries[0].Hostname != "host_one" || entries[1].Hostname != "host_two" {
+		t.Fatalf("expecting the staged operations to be applied, got: %v", entries[:2])
+	}
+
+	if err := tx.Commit(false); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expecting ErrTxDone, got: %v", err)
+	}
+
+	if err := tx.Add(*hostEntry3, 0); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expecting ErrTxDone, got: %v", err)
+	}
+}
+
+func TestHostsFileCtl_TxUndo(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hctl.Add(*hostEntry3, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	before := hctl.Entries()
+	tx := hctl.Begin()
+	for _, stage := range []func() error{
+		func() error { return tx.Add(*hostEntry1, 0) },
+		func() error { return tx.Update(1, *hostEntry2) },
+		func() error { return tx.Delete(-1) },
+	} {
+		if err := stage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(false); err != nil {
+		t.Fatal(err)
+	}
+	after := hctl.Entries()
+
+	history := hctl.History()
+	if len(history) != 2 || history[1].Kind != OpTx || len(history[1].Operations) != 3 || history[1].Operations[1].Kind != OpUpdate {
+		t.Fatalf("expecting the transaction as a single operation, got: %v", history)
+	}
+
+	// A single Undo reverts the whole transaction and nothing before it
+	if err := hctl.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := hctl.Entries(); !reflect.DeepEqual(entries, before) {
+		t.Fatalf("expecting every operation of the transaction to be undone, got: %v", entries)
+	}
+
+	if err := hctl.Redo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := hctl.Entries(); !reflect.DeepEqual(entries, after) {
+		t.Fatalf("expecting every operation of the transaction to be redone, got: %v", entries)
+	}
+}
+
+func TestHostsFileCtl_TxFailure(t *testing.T) {
+
+	hctl, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := hctl.Entries()
+	tx := hctl.Begin()
+
+	if err := tx.Add(HostEntry{Hostname: "no_ip"}, 0); err == nil {
+		t.Fatalf("expecting an invalid entry to be rejected when staged")
+	}
+
+	for n := 0; n < 3; n++ {
+		if err := tx.Delete(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tx.Add(*hostEntry1, len(before)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(false); err == nil {
+		t.Fatalf("expecting the out of range add to fail the commit")
+	}
+
+	if !reflect.DeepEqual(before, hctl.Entries()) {
+		t.Fatalf("expecting the entries to be left untouched")
+	}
+
+	tx = hctl.Begin()
+	if err := tx.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(false); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expecting ErrTxDone, got: %v", err)
+	}
+
+	if !reflect.DeepEqual(before, hctl.Entries()) {
+		t.Fatalf("expecting the entries to be left untouched")
+	}
+}
+
+func TestHostsFileCtl_TxCommitSync(t *testing.T) {
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_TxCommitSync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.WriteString("1.1.1.1 host_one\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	hctl, err := NewHostFileCtl(f.Name(), WithLossless())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := hctl.Begin()
+	if err := tx.Add(*hostEntry2, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(true); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "1.1.1.1 host_one\n" + hostEntry2.String() + "\n"; string(out) != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, out)
+	}
+
+	// A failed sync leaves the in-memory state untouched too
+	if err := ioutil.WriteFile(f.Name(), []byte("3.3.3.3 host_three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := hctl.Entries()
+	tx = hctl.Begin()
+	if err := tx.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var conflict *ConflictError
+	if err := tx.Commit(true); !errors.As(err, &conflict) {
+		t.Fatalf("expecting a conflict error, got: %v", err)
+	}
+
+	if !reflect.DeepEqual(before, hctl.Entries()) {
+		t.Fatalf("expecting the entries to be left untouched")
+	}
+}
@@ -0,0 +1,155 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxNameLength  = 253
+	MaxLabelLength = 63
+)
+
+var ErrInvalidName = errors.New("invalid name")
+
+// NameValidator checks a hostname or alias and returns an error describing the
+// rule it breaks
+type NameValidator func(name string) error
+
+var (
+	// PermissiveNames accepts letters, digits, dots, hyphens and underscores in
+	// any order, as found in Docker and other generated hosts files
+	PermissiveNames NameValidator = validatePermissive
+
+	// StrictNames accepts RFC 1123 hostnames only: dot separated labels of
+	// letters, digits and hyphens, not starting or ending with a hyphen, of at
+	// most 63 characters and 253 in total, with a top level label that is not
+	// all numeric. A trailing dot is allowed.
+	StrictNames NameValidator = validateStrict
+)
+
+func nameErrorf(name, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalidName, name, fmt.Sprintf(format, args...))
+}
+
+func validatePermissive(name string) error {
+
+	canonical := CanonicalName(name)
+	if len(canonical) == 0 {
+		return nameErrorf(name, "name is empty")
+	}
+
+	for n := 0; n < len(canonical); n++ {
+		if !isNameChar(canonical[n]) {
+			r, _ := utf8.DecodeRuneInString(canonical[n:])
+			return nameErrorf(name, "invalid character %q at offset %d, only letters, digits, dots, hyphens and underscores are allowed", r, n)
+		}
+	}
+
+	return nil
+}
+
+// isNameChar reports if c is allowed by PermissiveNames: a letter, digit, dot, hyphen or underscore
+func isNameChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '.', c == '-', c == '_':
+		return true
+	}
+	return false
+}
+
+// checkName returns the punycode form of a name once PermissiveNames accepts it
+func checkName(name string) (string, error) {
+
+	ascii, err := ToASCIIName(name)
+	if err != nil {
+		return name, nameErrorf(name, "%s", err)
+	}
+
+	return ascii, validatePermissive(ascii)
+}
+
+func validateStrict(name string) error {
+
+	canonical := CanonicalName(name)
+	if len(canonical) == 0 {
+		return nameErrorf(name, "name is empty")
+	}
+
+	if len(canonical) > MaxNameLength {
+		return nameErrorf(name, "name is %d characters long, the limit is %d", len(canonical), MaxNameLength)
+	}
+
+	labels := strings.Split(canonical, ".")
+	for _, label := range labels {
+
+		if len(label) == 0 {
+			return nameErrorf(name, "empty label, dots must separate labels")
+		}
+
+		if len(label) > MaxLabelLength {
+			return nameErrorf(name, "label %q is %d characters long, the limit is %d", label, len(label), MaxLabelLength)
+		}
+
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return nameErrorf(name, "label %q has invalid character %q, only letters, digits and hyphens are allowed", label, r)
+			}
+		}
+
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return nameErrorf(name, "label %q starts or ends with a hyphen", label)
+		}
+	}
+
+	if tld := labels[len(labels)-1]; strings.Trim(tld, "0123456789") == "" {
+		return nameErrorf(name, "top level label %q is all numeric", tld)
+	}
+
+	return nil
+}
+
+// ValidateNames checks the hostname and aliases of the entry with the
+// validator, comment lines have no names to check
+func (he *HostEntry) ValidateNames(validator NameValidator) error {
+
+	if he.isComment || he.IPAddress == nil {
+		return nil
+	}
+
+	if err := validator(he.Hostname); err != nil {
+		return &fieldError{field: 1, err: fmt.Errorf("hostname: %w", err)}
+	}
+
+	for n, alias := range he.Aliases {
+		if err := validator(alias); err != nil {
+			return &fieldError{field: n + 2, err: fmt.Errorf("alias %d: %w", n+1, err)}
+		}
+	}
+
+	return nil
+}
+
+// WithNameValidator validates hostnames and aliases of every entry read or
+// added with validator instead of PermissiveNames
+func WithNameValidator(validator NameValidator) Option {
+	return func(hfc *hostsFileCtl) error {
+		if validator == nil {
+			return fmt.Errorf("name validator cannot be nil")
+		}
+		hfc.nameValidator = validator
+		return nil
+	}
+}
+
+// validateNames checks the names of the entry with the configured validator
+func (hfc *hostsFileCtl) validateNames(entry *HostEntry) error {
+	if hfc.nameValidator == nil {
+		return entry.ValidateNames(PermissiveNames)
+	}
+	return entry.ValidateNames(hfc.nameValidator)
+}
@@ -0,0 +1,129 @@
+package go_hostctl
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNameValidators(t *testing.T) {
+
+	long := strings.Repeat("a", 64)
+	tests := []struct {
+		name       string
+		strict     string
+		permissive string
+	}{
+		{name: "api.internal"},
+		{name: "API.Internal."},
+		{name: "xn--bcher-kva.example"},
+		{name: "a-b.c0"},
+		{name: "some_server", strict: `label "some_server" has invalid character '_'`},
+		{name: "-foo..bar.", strict: `label "-foo" starts or ends with a hyphen`},
+		{name: "foo..bar", strict: "empty label"},
+		{name: "-foo.bar", strict: `label "-foo" starts or ends with a hyphen`},
+		{name: "foo-.bar", strict: `label "foo-" starts or ends with a hyphen`},
+		{name: long + ".com", strict: "is 64 characters long, the limit is 63"},
+		{name: strings.Repeat("abcdefghi.", 26) + "com", strict: "name is 263 characters long, the limit is 253"},
+		{name: "10.0.0.1", strict: `top level label "1" is all numeric`},
+		{name: ".", strict: "name is empty", permissive: "name is empty"},
+		{name: "foo:bar", strict: `invalid character ':'`, permissive: `invalid character ':' at offset 3`},
+	}
+
+	for _, test := range tests {
+		for _, check := range []struct {
+			validator NameValidator
+			expected  string
+		}{{StrictNames, test.strict}, {PermissiveNames, test.permissive}} {
+
+			err := check.validator(test.name)
+			if len(check.expected) == 0 {
+				if err != nil {
+					t.Fatalf("%s: expecting no error, got: %s", test.name, err)
+				}
+				continue
+			}
+
+			if !errors.Is(err, ErrInvalidName) || !strings.Contains(err.Error(), check.expected) {
+				t.Fatalf("%s: expecting an error containing %q, got: %v", test.name, check.expected, err)
+			}
+		}
+	}
+}
+
+func TestHostEntry_NameErrors(t *testing.T) {
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{line: "1.2.3.4 bad!host", expected: `hostname: invalid name "bad!host": invalid character '!' at offset 3`},
+		{line: "1.2.3.4 ok.host a:b", expected: `alias 1: invalid name "a:b": invalid character ':' at offset 1`},
+		{line: "1.2.3.4 # no hostname", expected: `hostname: invalid name "": name is empty`},
+	}
+
+	for _, test := range tests {
+		if _, err := ParseHostEntryLine([]byte(test.line)); !errors.Is(err, ErrInvalidName) || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expecting an error containing %q, got: %v", test.line, test.expected, err)
+		}
+	}
+
+	if _, err := NewHostEntry("1.2.3.4", "bad host!", ""); !errors.Is(err, ErrInvalidName) || !strings.Contains(err.Error(), `hostname: invalid name "bad host!": invalid character ' '`) {
+		t.Fatalf("expecting the rule broken by the hostname, got: %v", err)
+	}
+
+	if _, err := NewHostEntry("1.2.3.4", "", ""); !errors.Is(err, ErrInvalidName) || !strings.Contains(err.Error(), "name is empty") {
+		t.Fatalf("expecting a missing hostname to be reported, got: %v", err)
+	}
+}
+
+func TestHostsFileCtl_NameValidator(t *testing.T) {
+
+	if _, err := NewHostFileCtl("testdata/etc/hosts/mixed_hosts", WithNameValidator(StrictNames)); err == nil ||
+		!strings.Contains(err.Error(), `line 2 - hostname: invalid name "host_entry_0"`) {
+		t.Fatalf("expecting the underscore to be rejected on line 2, got: %v", err)
+	}
+
+	internalOnly := func(name string) error {
+		if !strings.HasSuffix(CanonicalName(name), ".internal") {
+			return fmt.Errorf("%w %q: only .internal names are allowed", ErrInvalidName, name)
+		}
+		return nil
+	}
+
+	f, err := ioutil.TempFile(os.TempDir(), "TestHostsFileCtl_NameValidator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	hctl, err := NewHostFileCtl(f.Name(), WithNameValidator(internalOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Commented out lines the validator rejects are kept as comments
+	if err := hctl.Read(strings.NewReader("# 10.0.0.1\tfoo.example\n10.0.0.2 api.internal\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := hctl.Entries(); len(entries) != 2 || !entries[0].isComment || entries[0].Disabled {
+		t.Fatalf("expecting a comment line, got: %v", entries)
+	}
+
+	if err := hctl.Add(*hostEntry1, -1); err == nil || !strings.Contains(err.Error(), "only .internal names are allowed") {
+		t.Fatalf("expecting host_one to be rejected, got: %v", err)
+	}
+
+	if _, err := hctl.Upsert("web.example", "10.0.0.3"); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("expecting web.example to be rejected, got: %v", err)
+	}
+
+	if err := hctl.Begin().Add(*hostEntry1, -1); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("expecting host_one to be rejected when staged, got: %v", err)
+	}
+}